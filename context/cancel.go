@@ -0,0 +1,63 @@
+package context
+
+import (
+	"bytes"
+	gocontext "context"
+	"io"
+	"io/ioutil"
+)
+
+// CompileContext is Compile that gives up when c is cancelled or its
+// deadline passes, returning the error of c.  Handlers and importers
+// called after that return an error, so libsass stops at the next call.
+// libsass itself can not be interrupted: Sass that calls neither, ie. a
+// runaway @while, keeps the compile and its goroutine running in the
+// background until it finishes.  The Context must not be reused once
+// CompileContext gives up.  out is only written to when the compile
+// succeeds.
+func (ctx *Context) CompileContext(c gocontext.Context, in io.Reader, out io.Writer) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	bs, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	ctx.cancel = c
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- ctx.Compile(bytes.NewReader(bs), &buf)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, &buf)
+		return err
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// Done is closed when the compile started by CompileContext is
+// cancelled.  Long running handlers should stop when it is closed.
+// Done returns nil, which is never closed, for other compiles.
+func (ctx *Context) Done() <-chan struct{} {
+	if ctx.cancel == nil {
+		return nil
+	}
+	return ctx.cancel.Done()
+}
+
+// Err returns the reason the compile was cancelled or nil if it has
+// not been.
+func (ctx *Context) Err() error {
+	if ctx.cancel == nil {
+		return nil
+	}
+	return ctx.cancel.Err()
+}
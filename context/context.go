@@ -1,22 +1,37 @@
 package context
 
 // #include <stdlib.h>
-// #include "sass_context.h"
+// #include "sass/context.h"
 //
-// extern union Sass_Value* GoBridge( union Sass_Value* s_args, void* cookie);
-// union Sass_Value* CallSassFunction( union Sass_Value* s_args, void* cookie ) {
-//     return GoBridge(s_args, cookie);
+// extern union Sass_Value* GoBridge( union Sass_Value* s_args, void* cookie, struct Sass_Compiler* comp );
+// union Sass_Value* CallSassFunction( const union Sass_Value* s_args, Sass_Function_Entry cb, struct Sass_Compiler* comp ) {
+//     return GoBridge((union Sass_Value*)s_args, sass_function_get_cookie(cb), comp);
+// }
+//
+// // lastImport is the path of the file containing the @import
+// char* lastImport( struct Sass_Compiler* comp ) {
+//     return (char*)sass_import_get_abs_path(sass_compiler_get_last_import(comp));
+// }
+//
+// extern Sass_Import_List ImportBridge( char* url, char* prev, void* cookie );
+// Sass_Import_List CallImporter( const char* url, Sass_Importer_Entry cb, struct Sass_Compiler* comp ) {
+//     return ImportBridge((char*)url, lastImport(comp), sass_importer_get_cookie(cb));
+// }
+//
+// extern Sass_Import_List HeaderBridge( char* url, char* prev, void* cookie );
+// Sass_Import_List CallHeader( const char* url, Sass_Importer_Entry cb, struct Sass_Compiler* comp ) {
+//     return HeaderBridge((char*)url, lastImport(comp), sass_importer_get_cookie(cb));
 // }
 import "C"
 
 import (
-	"bytes"
+	gocontext "context"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
-	"reflect"
+	"strings"
 
 	"github.com/wellington/spritewell"
 
@@ -36,21 +51,75 @@ type Context struct {
 	FontDir, ImageDir string
 	// Output/build directories
 	BuildDir, GenImgDir string
+	// CacheDir keeps state between compiles, when set sprites are
+	// not exported again if their source images are unchanged.
+	CacheDir string
 
 	In, Src, Out, Map, MainFile string
-	Status                      int
-	errorString                 string
-	errors                      lErrors
+	// IndentedSyntax reads the input of Compile as the indented Sass
+	// syntax, it is implied by a MainFile ending in .sass.  CompileFile
+	// and imports are detected by their extension.
+	IndentedSyntax bool
+	// Source maps are generated when Map, the path of the source map
+	// file, is set.  Out is the path of the CSS, it is used to create
+	// the sourceMappingURL.  MapEmbed includes the map in the CSS as a
+	// data uri, MapContents includes the sources in the map and
+	// MapOmitURL leaves out the sourceMappingURL comment.
+	MapEmbed, MapContents, MapOmitURL bool
+	sourceMap                         string
+	// included are the files read during the last compile
+	included []string
+	// sprites are the keys in Sprites used by the last compile
+	sprites []string
+
+	Status      int
+	errorString string
+	errors      lErrors
 
 	in     io.Reader
 	out    io.Writer
 	Errors SassError
+	// LookupPosition translates a line of the input to the file and
+	// line it came from, ie. Parser.LookupPosition.  It sets the
+	// Partial of a CompileError in stdin.
+	LookupPosition func(line int) (string, int)
+	// Cookies are functions added to this Context, they replace
+	// functions in Funcs with the same name.
+	Cookies []Cookie
+	// Funcs are the functions available to Sass, DefaultRegistry is
+	// used when nil.
+	Funcs *Registry
 	// Place to keep cookies, so Go doesn't garbage collect them before C
 	// is done with them
-	Cookies []Cookie
+	funcs []Cookie
+	// cookies are the keys passed to libsass by the last compile
+	cookies []unsafe.Pointer
+
+	// Importers resolve @import statements before libsass looks for
+	// files.  They are tried in order until one does not return
+	// ErrSkipImport.
+	Importers []ImportFunc
+	// Header is Sass loaded before the input, ie. shared mixins.  It
+	// is passed to libsass separately so line numbers are unchanged.
+	// Header follows the headers of Funcs.
+	Header  string
+	headers []header
+	// cookie is the key of this Context for the importer bridges
+	cookie unsafe.Pointer
+	// cancel is the context passed to CompileContext
+	cancel gocontext.Context
+
+	// Warnings from @warn, @debug and handlers during the last compile.
+	// OnWarning is called with each warning as it happens.
+	Warnings  []Warning
+	OnWarning func(Warning)
+	// calleeFile and calleeLine locate the call of the running handler
+	calleeFile string
+	calleeLine int
 
 	// Used for callbacks to retrieve sprite information, etc.
-	Imgs, Sprites spritewell.SafeImageMap
+	// These may be shared between Contexts compiling concurrently.
+	Imgs, Sprites *spritewell.SafeImageMap
 	// Special variable for debugging bad parsing
 	// debug []byte
 }
@@ -78,9 +147,9 @@ func NewContext() *Context {
 	c := Context{}
 
 	// Initiailize image map(s)
-	c.Sprites = spritewell.SafeImageMap{
+	c.Sprites = &spritewell.SafeImageMap{
 		M: make(map[string]spritewell.ImageList, 100)}
-	c.Imgs = spritewell.SafeImageMap{
+	c.Imgs = &spritewell.SafeImageMap{
 		M: make(map[string]spritewell.ImageList, 100)}
 
 	return &c
@@ -88,65 +157,98 @@ func NewContext() *Context {
 
 // Init validates options in the struct and returns a Sass Options.
 func (ctx *Context) Init(dc *C.struct_Sass_Data_Context) *C.struct_Sass_Options {
+	return ctx.init(C.sass_data_context_get_options(dc))
+}
+
+// init applies the options in the struct to opts.
+func (ctx *Context) init(opts *C.struct_Sass_Options) *C.struct_Sass_Options {
 	if ctx.Precision == 0 {
 		ctx.Precision = 5
 	}
+	if ctx.Sprites == nil {
+		ctx.Sprites = &spritewell.SafeImageMap{
+			M: make(map[string]spritewell.ImageList, 100)}
+	}
+	if ctx.Imgs == nil {
+		ctx.Imgs = &spritewell.SafeImageMap{
+			M: make(map[string]spritewell.ImageList, 100)}
+	}
 	cmt := C.bool(ctx.Comments)
 	imgpath := C.CString(ctx.ImageDir)
 	prec := C.int(ctx.Precision)
 
-	opts := C.sass_data_context_get_options(dc)
-
 	defer func() {
 		C.free(unsafe.Pointer(imgpath))
 		// C.free(unsafe.Pointer(cc))
 		// C.sass_delete_data_context(dc)
 	}()
-	cookies := make([]Cookie, len(handlers)+len(ctx.Cookies))
-	// Append registered handlers to cookie array
-	for i, h := range handlers {
-		cookies[i] = Cookie{
-			h.sign, h.callback, ctx,
-		}
+	ctx.Warnings = nil
+	ctx.included = nil
+	ctx.sprites = nil
+	// Cookies override registered functions with the same name
+	reg := NewRegistry(warnFuncs, ctx.registry())
+	for _, ck := range ctx.Cookies {
+		reg.Register(ck.Sign, ck.Fn)
 	}
-	for i, h := range ctx.Cookies {
-		cookies[i+len(handlers)] = Cookie{
-			h.Sign, h.Fn, ctx,
+	hs := reg.list()
+	ctx.funcs = make([]Cookie, len(hs))
+	for i, h := range hs {
+		ctx.funcs[i] = Cookie{
+			h.sign, h.callback, ctx,
 		}
 	}
-	ctx.Cookies = cookies
-	size := C.size_t(len(ctx.Cookies))
-	fns := C.sass_make_function_list(size)
-	signatures := make([]string, len(ctx.Cookies))
-	// Send cookies to libsass
-	// Create a slice that's backed by a C array
-	length := len(ctx.Cookies) + 1
-	hdr := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(fns)),
-		Len:  length, Cap: length,
-	}
-	gofns := *(*[]C.Sass_C_Function_Callback)(unsafe.Pointer(&hdr))
-	for i, v := range ctx.Cookies {
-		signatures[i] = ctx.Cookies[i].Sign
-		_ = v
-		cg := C.CString(signatures[i])
-		_ = cg
-
+	// Send cookies to libsass, it owns the list and its entries
+	fns := C.sass_make_function_list(C.size_t(len(ctx.funcs)))
+	for i, v := range ctx.funcs {
+		// libsass copies the signature
+		sign := C.CString(v.Sign)
 		fn := C.sass_make_function(
-			// sass signature
-			C.CString(v.Sign),
+			sign,
 			// C bridge
-			C.Sass_C_Function(C.CallSassFunction),
-			// Only pass reference to global array, so
-			// GC won't clean it up.
-			unsafe.Pointer(&ctx.Cookies[i]))
-
-		gofns[i] = fn
+			C.Sass_Function_Fn(C.CallSassFunction),
+			// Go pointers can not be passed to C, pass a key
+			// of the cookie instead.
+			ctx.newCookie(&ctx.funcs[i]))
+		C.free(unsafe.Pointer(sign))
+		C.sass_function_set_list_entry(fns, C.size_t(i), fn)
 	}
-
-	C.sass_option_set_c_functions(opts, (C.Sass_C_Function_List)(unsafe.Pointer(&gofns[0])))
+	C.sass_option_set_c_functions(opts, fns)
+	if len(ctx.Importers) > 0 {
+		C.sass_option_set_c_importers(opts,
+			importerList(C.Sass_Importer_Fn(C.CallImporter), ctx.importCookie()))
+	}
+	ctx.headers = reg.headerList()
+	if ctx.Header != "" {
+		ctx.headers = append(ctx.headers, header{"header", ctx.Header})
+	}
+	if len(ctx.headers) > 0 {
+		C.sass_option_set_c_headers(opts,
+			importerList(C.Sass_Importer_Fn(C.CallHeader), ctx.importCookie()))
+	}
+	if len(ctx.IncludePaths) > 0 {
+		// libsass copies the include path
+		paths := C.CString(strings.Join(ctx.IncludePaths,
+			string(os.PathListSeparator)))
+		defer C.free(unsafe.Pointer(paths))
+		C.sass_option_set_include_path(opts, paths)
+	}
+	C.sass_option_set_output_style(opts, C.enum_Sass_Output_Style(ctx.OutputStyle))
 	C.sass_option_set_precision(opts, prec)
 	C.sass_option_set_source_comments(opts, cmt)
+	C.sass_option_set_is_indented_syntax_src(opts,
+		C.bool(ctx.IndentedSyntax || Indented(ctx.MainFile)))
+	if ctx.Map != "" {
+		// libsass copies the paths
+		cout := C.CString(ctx.Out)
+		defer C.free(unsafe.Pointer(cout))
+		cmap := C.CString(ctx.Map)
+		defer C.free(unsafe.Pointer(cmap))
+		C.sass_option_set_output_path(opts, cout)
+		C.sass_option_set_source_map_file(opts, cmap)
+		C.sass_option_set_source_map_embed(opts, C.bool(ctx.MapEmbed))
+		C.sass_option_set_source_map_contents(opts, C.bool(ctx.MapContents))
+		C.sass_option_set_omit_source_map_url(opts, C.bool(ctx.MapOmitURL))
+	}
 	return opts
 }
 
@@ -163,13 +265,13 @@ func (ctx *Context) Compile(in io.Reader, out io.Writer) error {
 	if len(bs) == 0 {
 		return errors.New("No input provided")
 	}
+	// libsass takes ownership of the source
 	src := C.CString(string(bs))
-	defer C.free(unsafe.Pointer(src))
-
 	dc := C.sass_make_data_context(src)
 	defer C.sass_delete_data_context(dc)
 
 	opts := ctx.Init(dc)
+	defer ctx.release()
 	// TODO: Manually free options memory without throwing
 	// malloc errors
 	// defer C.free(unsafe.Pointer(opts))
@@ -183,33 +285,128 @@ func (ctx *Context) Compile(in io.Reader, out io.Writer) error {
 		C.sass_delete_compiler(compiler)
 	}()
 
+	return ctx.result(cc, out, bs)
+}
+
+// CompileFile compiles the file at path and writes the result to out.
+// libsass reads the file, so errors, source comments and source maps
+// refer to the path instead of stdin.
+func (ctx *Context) CompileFile(path string, out io.Writer) error {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	fc := C.sass_make_file_context(cpath)
+	defer C.sass_delete_file_context(fc)
+
+	opts := ctx.init(C.sass_file_context_get_options(fc))
+	defer ctx.release()
+	C.sass_file_context_set_options(fc, opts)
+	cc := C.sass_file_context_get_context(fc)
+	compiler := C.sass_make_file_compiler(fc)
+
+	C.sass_compiler_parse(compiler)
+	C.sass_compiler_execute(compiler)
+	defer func() {
+		C.sass_delete_compiler(compiler)
+	}()
+
+	return ctx.result(cc, out, nil)
+}
+
+// result writes the output of a compile to out and collects errors.
+// Errors from libsass are returned as a *CompileError.  src is used to
+// show the lines around an error, when nil the file the error happened
+// in is read.
+func (ctx *Context) result(cc *C.struct_Sass_Context, out io.Writer, src []byte) error {
 	cout := C.GoString(C.sass_context_get_output_string(cc))
 	io.WriteString(out, cout)
+	ctx.sourceMap = C.GoString(C.sass_context_get_source_map_string(cc))
+	ctx.included = append(includedFiles(cc), ctx.included...)
 
 	ctx.Status = int(C.sass_context_get_error_status(cc))
 	errJSON := C.sass_context_get_error_json(cc)
-	err = ctx.ProcessSassError([]byte(C.GoString(errJSON)))
+	err := ctx.ProcessSassError([]byte(C.GoString(errJSON)))
 
 	if err != nil {
 		return err
 	}
 
 	if ctx.error() != "" {
-		lines := bytes.Split(bs, []byte("\n"))
-		var out string
-		for i := -7; i < 7; i++ {
-			if i+ctx.Errors.Line >= 0 && i+ctx.Errors.Line < len(lines) {
-				out += fmt.Sprintf("%s\n", string(lines[i+ctx.Errors.Line]))
-			}
+		// src is only the input, errors in imports are read
+		// from their file
+		if src == nil || ctx.Errors.File != "stdin" {
+			src, _ = ioutil.ReadFile(ctx.Errors.File)
 		}
-
-		// TODO: this is weird, make something more idiomatic
-		return fmt.Errorf(ctx.error() + "\n" + out)
+		return ctx.compileError(src)
 	}
 
 	return nil
 }
 
+// SourceMap returns the source map created by the last call to Compile.
+// Map must be set for a source map to be created.
+func (ctx *Context) SourceMap() string {
+	return ctx.sourceMap
+}
+
+// IncludeFile records paths as read by the current compile, handlers
+// call it for the images and fonts they use.
+func (ctx *Context) IncludeFile(paths ...string) {
+	ctx.included = append(ctx.included, paths...)
+}
+
+// IncludedFiles lists the files read by the last compile: the input
+// file, every partial and the images and fonts used by handlers.
+// Headers are not files and are left out.
+func (ctx *Context) IncludedFiles() []string {
+	seen := make(map[string]bool, len(ctx.included))
+	var files []string
+	for _, f := range ctx.included {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// IncludeSprite records the key in Sprites of a sprite used by the
+// current compile.
+func (ctx *Context) IncludeSprite(key string) {
+	ctx.sprites = append(ctx.sprites, key)
+}
+
+// IncludedSprites lists the keys in Sprites of the sprites used by the
+// last compile.
+func (ctx *Context) IncludedSprites() []string {
+	seen := make(map[string]bool, len(ctx.sprites))
+	var keys []string
+	for _, k := range ctx.sprites {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// includedFiles returns the files libsass read, stdin is left out.
+func includedFiles(cc *C.struct_Sass_Context) []string {
+	cfiles := C.sass_context_get_included_files(cc)
+	if cfiles == nil {
+		return nil
+	}
+	// The list is terminated by NULL
+	arr := (*[1 << 20]*C.char)(unsafe.Pointer(cfiles))
+	var files []string
+	for i := 0; arr[i] != nil; i++ {
+		if f := C.GoString(arr[i]); f != "stdin" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
 // Rel creates relative paths between the build directory where the CSS lives
 // and the image directory that is being linked.  This is not compatible
 // with generated images like sprites.
@@ -2,6 +2,9 @@ package context
 
 import (
 	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image/color"
 	"io"
@@ -11,7 +14,9 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/wellington/spritewell"
 )
@@ -132,6 +137,32 @@ div {
 
 }
 
+func TestContextOutputStyle(t *testing.T) {
+	in := `div {
+  color: red;
+  p { margin: 0; }
+}`
+	styles := map[int]string{
+		NESTED_STYLE: `div {
+  color: red; }
+  div p {
+    margin: 0; }
+`,
+		COMPRESSED_STYLE: "div{color:red}div p{margin:0}\n",
+	}
+	for style, e := range styles {
+		var out bytes.Buffer
+		ctx := Context{OutputStyle: style}
+		err := ctx.Compile(bytes.NewBufferString(in), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e != out.String() {
+			t.Errorf("style %d got:\n%q\nwanted:\n%q", style, out.String(), e)
+		}
+	}
+}
+
 func TestContextCustomSimpleTypes(t *testing.T) {
 	in := bytes.NewBufferString(`div {
   background: foo(null, 3px, asdf, false, #005500);
@@ -235,11 +266,11 @@ func TestContextCustomArity(t *testing.T) {
 		t.Error("No error thrown for incorrect arity")
 	}
 
-	if e := "function foo only takes 0 arguments; given 2"; e != ctx.Errors.Message {
+	if e := "wrong number of arguments (2 for 0) for `foo'"; e != ctx.Errors.Message {
 		t.Errorf("wanted:\n%s\ngot:\n%s\n", e, ctx.Errors.Message)
 	}
 	e := `Error > stdin:3
-function foo only takes 0 arguments; given 2
+wrong number of arguments (2 for 0) for ` + "`foo'" + `
 div {
   color: red(blue);
   background: foo(1pt, 2cm);
@@ -271,11 +302,11 @@ func TestLibsassError(t *testing.T) {
 		t.Error("No error thrown for incorrect arity")
 	}
 
-	if e := "function red only takes 1 arguments; given 2"; e != ctx.Errors.Message {
+	if e := "wrong number of arguments (2 for 1) for `red'"; e != ctx.Errors.Message {
 		t.Errorf("wanted:\n%s\ngot:\n%s\n", e, ctx.Errors.Message)
 	}
 	e := `Error > stdin:2
-function red only takes 1 arguments; given 2
+wrong number of arguments (2 for 1) for ` + "`red'" + `
 div {
   color: red(blue, purple);
 }
@@ -331,3 +362,309 @@ func BenchmarkContextCompile(b *testing.B) {
 		}
 	}
 }
+
+func TestContextSourceMap(t *testing.T) {
+	in := bytes.NewBufferString(`div {
+  p {
+    color: red;
+  }
+}`)
+
+	var out bytes.Buffer
+	ctx := Context{
+		Out: "test/build/map.css",
+		Map: "test/build/map.css.map",
+	}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := "sourceMappingURL=map.css.map"; !strings.Contains(out.String(), e) {
+		t.Errorf("%s not found in:\n%s", e, out.String())
+	}
+
+	var sm struct {
+		Version  int
+		Mappings string
+	}
+	err = json.Unmarshal([]byte(ctx.SourceMap()), &sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Version != 3 || sm.Mappings == "" {
+		t.Errorf("invalid source map: %s", ctx.SourceMap())
+	}
+}
+
+func TestContextSourceMapPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sourcemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main.scss")
+	partial := filepath.Join(dir, "_list.scss")
+	ioutil.WriteFile(partial, []byte("ul {\n  margin: 0;\n}\n"), 0644)
+	ioutil.WriteFile(main, []byte(`@import "list";
+div {
+  color: red;
+}`), 0644)
+
+	var out bytes.Buffer
+	ctx := Context{
+		Out: filepath.Join(dir, "main.css"),
+		Map: filepath.Join(dir, "main.css.map"),
+	}
+	err = ctx.CompileFile(main, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sm struct {
+		Sources []string
+	}
+	err = json.Unmarshal([]byte(ctx.SourceMap()), &sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sources are relative to the source map
+	found := map[string]bool{}
+	for _, src := range sm.Sources {
+		found[filepath.Join(dir, src)] = true
+	}
+	if !found[partial] || !found[main] {
+		t.Errorf("got sources: %v wanted: %s and %s", sm.Sources, main, partial)
+	}
+}
+
+func TestContextImporter(t *testing.T) {
+	in := bytes.NewBufferString(`@import "colors";
+@import "missing";
+div {
+  color: $red;
+}`)
+
+	var out bytes.Buffer
+	ctx := Context{}
+	var prevs []string
+	ctx.Importers = []ImportFunc{
+		func(ctx *Context, url, prev string) (string, []byte, error) {
+			prevs = append(prevs, prev)
+			if url != "colors" {
+				return "", nil, ErrSkipImport
+			}
+			return "colors.scss", []byte("$red: #f00;"), nil
+		},
+		func(ctx *Context, url, prev string) (string, []byte, error) {
+			if url != "missing" {
+				return "", nil, ErrSkipImport
+			}
+			return "", []byte{}, nil
+		},
+	}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := `div {
+  color: #f00; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+	if len(prevs) != 2 || prevs[0] != "stdin" {
+		t.Errorf("importer was called from: %v", prevs)
+	}
+}
+
+func TestContextImporterError(t *testing.T) {
+	in := bytes.NewBufferString(`@import "colors";`)
+
+	var out bytes.Buffer
+	ctx := Context{}
+	ctx.Importers = []ImportFunc{
+		func(ctx *Context, url, prev string) (string, []byte, error) {
+			return "", nil, errors.New("no colors today")
+		},
+	}
+	err := ctx.Compile(in, &out)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if e := "no colors today"; !strings.Contains(ctx.Errors.Message, e) {
+		t.Errorf("got: %s wanted: %s", ctx.Errors.Message, e)
+	}
+}
+
+func TestContextCompileFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compilefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "main.scss")
+	ioutil.WriteFile(filepath.Join(dir, "_colors.scss"), []byte("$red: #f00;\n"), 0644)
+	ioutil.WriteFile(main, []byte(`@import "colors";
+div {
+  color: $red;
+}`), 0644)
+
+	var out bytes.Buffer
+	ctx := Context{Header: "$size: 2px;"}
+	err = ctx.CompileFile(main, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  color: #f00; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+	files := []string{main, filepath.Join(dir, "_colors.scss")}
+	if !reflect.DeepEqual(files, ctx.IncludedFiles()) {
+		t.Errorf("got: %v wanted: %v", ctx.IncludedFiles(), files)
+	}
+
+	ioutil.WriteFile(main, []byte(`div {
+  color: $blue;
+}`), 0644)
+	out.Reset()
+	err = ctx.CompileFile(main, &out)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if ctx.Errors.File != main || ctx.Errors.Line != 2 {
+		t.Errorf("got: %s:%d wanted: %s:2",
+			ctx.Errors.File, ctx.Errors.Line, main)
+	}
+}
+
+func TestContextHeader(t *testing.T) {
+	in := bytes.NewBufferString(`div {
+  @include square(2px);
+}`)
+
+	var out bytes.Buffer
+	ctx := Context{
+		Header: `@mixin square($size) {
+  width: $size;
+  height: $size;
+}`,
+	}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  width: 2px;
+  height: 2px; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+}
+
+func TestContextCompileContext(t *testing.T) {
+	in := bytes.NewBufferString(`div {
+  width: slow();
+}`)
+
+	ctx := Context{}
+	calls := make(chan error, 2)
+	ctx.Cookies = []Cookie{{
+		"slow()", func(c *Context, usv UnionSassValue) UnionSassValue {
+			<-c.Done()
+			calls <- c.Err()
+			res, _ := Marshal("1px")
+			return res
+		}, &ctx,
+	}}
+
+	c, cancel := gocontext.WithTimeout(gocontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	err := ctx.CompileContext(c, in, &out)
+	if err != gocontext.DeadlineExceeded {
+		t.Errorf("got: %v wanted: %v", err, gocontext.DeadlineExceeded)
+	}
+	if out.Len() != 0 {
+		t.Errorf("output was written: %s", out.String())
+	}
+	if err := <-calls; err != gocontext.DeadlineExceeded {
+		t.Errorf("handler got: %v wanted: %v", err, gocontext.DeadlineExceeded)
+	}
+}
+
+func TestContextCompileContextImport(t *testing.T) {
+	ctx := Context{}
+	var imported bool
+	ctx.Importers = []ImportFunc{
+		func(c *Context, url, prev string) (string, []byte, error) {
+			imported = true
+			return url + ".scss", []byte(`$red: red;`), nil
+		},
+	}
+	// A compile abandoned by CompileContext keeps running
+	c, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	ctx.cancel = c
+	err := ctx.Compile(bytes.NewBufferString(`@import "colors";
+div { color: $red; }`), ioutil.Discard)
+	if err == nil {
+		t.Error("cancelled compile succeeded")
+	}
+	if imported {
+		t.Error("importer was called after the compile was cancelled")
+	}
+}
+
+func TestContextCompileContextCancelled(t *testing.T) {
+	c, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	ctx := Context{}
+	var out bytes.Buffer
+	err := ctx.CompileContext(c, bytes.NewBufferString(`div { color: red; }`), &out)
+	if err != gocontext.Canceled {
+		t.Errorf("got: %v wanted: %v", err, gocontext.Canceled)
+	}
+
+	// Done is nil when the compile can not be cancelled
+	ctx = Context{}
+	if ctx.Done() != nil || ctx.Err() != nil {
+		t.Error("Context without CompileContext was cancelled")
+	}
+}
+
+func TestContextIndented(t *testing.T) {
+	in := bytes.NewBufferString(`@import "box"
+div
+  @include box(2px)
+  color: $red
+`)
+
+	var out bytes.Buffer
+	ctx := Context{IndentedSyntax: true}
+	ctx.Importers = []ImportFunc{
+		func(ctx *Context, url, prev string) (string, []byte, error) {
+			return "_box.sass", []byte(`$red: #f00
+
+=box($size)
+  width: $size
+`), nil
+		},
+	}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  width: 2px;
+  color: #f00; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"image/color"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-// #include "sass_context.h"
+// #include "sass/context.h"
 import "C"
 
 type UnionSassValue *C.union_Sass_Value
@@ -44,6 +45,9 @@ func unmarshal(arg UnionSassValue, v interface{}) error {
 		case bool(C.sass_value_is_list(arg)):
 			k = reflect.Slice
 			t = reflect.SliceOf(t)
+		case bool(C.sass_value_is_map(arg)):
+			k = reflect.Map
+			t = reflect.MapOf(reflect.TypeOf(""), t)
 		case bool(C.sass_value_is_error(arg)):
 			// This should get implemented as type error
 			k = reflect.String
@@ -107,6 +111,9 @@ func unmarshal(arg UnionSassValue, v interface{}) error {
 			}
 			f.Set(reflect.ValueOf(sn))
 
+		} else if C.sass_value_is_map(arg) && t.Kind() == reflect.Struct &&
+			len(structFields(t)) > 0 {
+			return unmarshalStruct(arg, f)
 		} else {
 			return throwMisMatchTypeError(arg, "color.RGBA or SassNumber")
 		}
@@ -119,16 +126,123 @@ func unmarshal(arg UnionSassValue, v interface{}) error {
 				if err != nil {
 					return err
 				}
+				if !reflect.TypeOf(l[i]).AssignableTo(t.Elem()) {
+					return throwMisMatchTypeError(C.sass_list_get_value(arg, C.size_t(i)), t.Elem().String())
+				}
 				newv.Index(i).Set(reflect.ValueOf(l[i]))
 			}
 			f.Set(newv)
 		} else {
 			return throwMisMatchTypeError(arg, "slice")
 		}
+	case reflect.Map:
+		if !C.sass_value_is_map(arg) {
+			return throwMisMatchTypeError(arg, "map")
+		}
+		if t.Key().Kind() != reflect.String {
+			return fmt.Errorf("map keys must be strings, not %s", t.Key())
+		}
+		n := int(C.sass_map_get_length(arg))
+		newm := reflect.MakeMap(t)
+		for i := 0; i < n; i++ {
+			key, err := mapKey(C.sass_map_get_key(arg, C.size_t(i)))
+			if err != nil {
+				return err
+			}
+			val := reflect.New(t.Elem())
+			err = unmarshal(C.sass_map_get_value(arg, C.size_t(i)), val.Interface())
+			if err != nil {
+				return err
+			}
+			newm.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), val.Elem())
+		}
+		f.Set(newm)
 	}
 	return nil
 }
 
+// unmarshalStruct sets the fields of the struct f from the Sass map
+// arg, keys without a matching field are ignored.
+func unmarshalStruct(arg UnionSassValue, f reflect.Value) error {
+	fields := make(map[string]int)
+	for _, fd := range structFields(f.Type()) {
+		fields[fd.name] = fd.index
+	}
+	for i := 0; i < int(C.sass_map_get_length(arg)); i++ {
+		key, err := mapKey(C.sass_map_get_key(arg, C.size_t(i)))
+		if err != nil {
+			return err
+		}
+		idx, ok := fields[key]
+		if !ok {
+			continue
+		}
+		val := reflect.New(f.Field(idx).Type())
+		err = unmarshal(C.sass_map_get_value(arg, C.size_t(i)), val.Interface())
+		if err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+		f.Field(idx).Set(val.Elem())
+	}
+	return nil
+}
+
+// structField is a field of a struct encoded as a Sass map.
+type structField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+// structFields lists the exported fields of t with the map key from
+// their sass tag, ie.
+//
+//	Width SassNumber `sass:"width"`
+//	Name  string     `sass:"name,omitempty"`
+//	Skip  string     `sass:"-"`
+//
+// Fields without a tag use the field name.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("sass")
+		if tag == "-" {
+			continue
+		}
+		fd := structField{index: i, name: sf.Name}
+		opts := strings.Split(tag, ",")
+		if opts[0] != "" {
+			fd.name = opts[0]
+		}
+		for _, o := range opts[1:] {
+			if o == "omitempty" {
+				fd.omitEmpty = true
+			}
+		}
+		fields = append(fields, fd)
+	}
+	return fields
+}
+
+// mapKey returns the key of a Sass map as a string.  Numbers, ie. the
+// image names of a sprite map, are formatted with their unit.
+func mapKey(arg UnionSassValue) (string, error) {
+	if C.sass_value_is_number(arg) {
+		v := strconv.FormatFloat(float64(C.sass_number_get_value(arg)), 'f', -1, 64)
+		if noSassNumberUnit(arg) {
+			return v, nil
+		}
+		return v + C.GoString(C.sass_number_get_unit(arg)), nil
+	}
+	var key string
+	err := unmarshal(arg, &key)
+	return key, err
+}
+
 // Decode converts Sass Value to Go compatible data types.
 func Unmarshal(arg UnionSassValue, v ...interface{}) error {
 	var err error
@@ -208,13 +322,15 @@ func makevalue(v interface{}) (UnionSassValue, error) {
 		} else if reflect.TypeOf(v).String() == "color.RGBA" {
 			var sc = v.(color.RGBA)
 			return C.sass_make_color(C.double(sc.R), C.double(sc.G), C.double(sc.B), C.double(sc.A)), err
+		} else if fields := structFields(f.Type()); len(fields) > 0 {
+			return makemap(f, fields)
 		} else {
 			err = errors.New(fmt.Sprintf("The struct type %s is unsupported for marshalling", reflect.TypeOf(v).String()))
 			return C.sass_make_null(), err
 		}
 	case reflect.Slice:
 		// Initialize the list
-		l := C.sass_make_list(C.size_t(f.Len()), C.SASS_COMMA)
+		l := C.sass_make_list(C.size_t(f.Len()), C.SASS_COMMA, false)
 		for i := 0; i < f.Len(); i++ {
 			t, er := makevalue(f.Index(i).Interface())
 			if err == nil && er != nil {
@@ -223,7 +339,49 @@ func makevalue(v interface{}) (UnionSassValue, error) {
 			C.sass_list_set_value(l, C.size_t(i), t)
 		}
 		return l, err
+	case reflect.Map:
+		if f.Type().Key().Kind() != reflect.String {
+			err = fmt.Errorf("map keys must be strings, not %s", f.Type().Key())
+			return C.sass_make_null(), err
+		}
+		// Sort the keys so the map is always created in the same order
+		keys := f.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		m := C.sass_make_map(C.size_t(len(keys)))
+		for i, key := range keys {
+			t, er := makevalue(f.MapIndex(key).Interface())
+			if err == nil && er != nil {
+				err = er
+			}
+			C.sass_map_set_key(m, C.size_t(i), C.sass_make_string(C.CString(key.String())))
+			C.sass_map_set_value(m, C.size_t(i), t)
+		}
+		return m, err
+	}
+}
+
+// makemap creates a Sass map from the fields of the struct f.
+func makemap(f reflect.Value, fields []structField) (UnionSassValue, error) {
+	var err error
+	var set []structField
+	for _, fd := range fields {
+		if fd.omitEmpty && f.Field(fd.index).IsZero() {
+			continue
+		}
+		set = append(set, fd)
+	}
+	m := C.sass_make_map(C.size_t(len(set)))
+	for i, fd := range set {
+		t, er := makevalue(f.Field(fd.index).Interface())
+		if err == nil && er != nil {
+			err = er
+		}
+		C.sass_map_set_key(m, C.size_t(i), C.sass_make_string(C.CString(fd.name)))
+		C.sass_map_set_value(m, C.size_t(i), t)
 	}
+	return m, err
 }
 
 func throwMisMatchTypeError(arg UnionSassValue, expectedType string) error {
@@ -1,6 +1,7 @@
 package context
 
 import (
+	"bytes"
 	"fmt"
 	"image/color"
 	"reflect"
@@ -368,3 +369,127 @@ func TestWrongUnmarshalToFloatType(t *testing.T) {
 		t.Errorf("got: %s wanted: %s", err, e)
 	}
 }
+
+func TestMarshalMap(t *testing.T) {
+	m := map[string]interface{}{
+		"spacing": SassNumber{4, "px"},
+		"layout":  "horizontal",
+		"pos": map[string]interface{}{
+			"x": SassNumber{1, "px"},
+			"y": SassNumber{2, "px"},
+		},
+		"names": []interface{}{"a", "b"},
+	}
+	sv := testMarshal(t, m)
+
+	var res interface{}
+	err := Unmarshal(sv, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, res) {
+		t.Errorf("got: %#v wanted: %#v", res, m)
+	}
+
+	var nums map[string]SassNumber
+	err = Unmarshal(testMarshal(t, map[string]SassNumber{
+		"x": {1, "px"},
+	}), &nums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := (map[string]SassNumber{"x": {1, "px"}}); !reflect.DeepEqual(e, nums) {
+		t.Errorf("got: %v wanted: %v", nums, e)
+	}
+
+	err = Unmarshal(sv, &nums)
+	if err == nil {
+		t.Error("No error thrown for mismatched map values")
+	}
+	var s string
+	err = Unmarshal(sv, &s)
+	if err == nil {
+		t.Error("No error thrown for unmarshalling a map to string")
+	}
+
+	if _, err := Marshal(map[int]string{1: "a"}); err == nil {
+		t.Error("No error thrown for int map keys")
+	}
+}
+
+func TestUnmarshalMapArgument(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterFunc("option", func(opts map[string]interface{}, name string) interface{} {
+		return opts[name]
+	})
+	in := bytes.NewBufferString(`div {
+  margin: option((spacing: 4px, layout: horizontal), spacing);
+  float: option((139: left, 140: right), "140");
+}`)
+	var out bytes.Buffer
+	ctx := Context{Funcs: r}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  margin: 4px;
+  float: right; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+}
+
+type spriteInfo struct {
+	Width  SassNumber `sass:"width"`
+	Height SassNumber `sass:"height"`
+	X      SassNumber `sass:"x"`
+	Y      SassNumber `sass:"y"`
+	URL    string     `sass:"url,omitempty"`
+	Path   string     `sass:"-"`
+	Name   string
+	hidden string
+}
+
+func TestMarshalStruct(t *testing.T) {
+	info := spriteInfo{
+		Width:  SassNumber{10, "px"},
+		Height: SassNumber{20, "px"},
+		X:      SassNumber{0, "px"},
+		Y:      SassNumber{40, "px"},
+		Path:   "img/139.png",
+		Name:   "139",
+		hidden: "hidden",
+	}
+	sv := testMarshal(t, info)
+
+	var m map[string]interface{}
+	err := Unmarshal(sv, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := map[string]interface{}{
+		"width":  SassNumber{10, "px"},
+		"height": SassNumber{20, "px"},
+		"x":      SassNumber{0, "px"},
+		"y":      SassNumber{40, "px"},
+		"Name":   "139",
+	}
+	if !reflect.DeepEqual(e, m) {
+		t.Errorf("got: %#v wanted: %#v", m, e)
+	}
+
+	var res spriteInfo
+	err = Unmarshal(testMarshal(t, map[string]interface{}{
+		"width":   SassNumber{10, "px"},
+		"url":     "sprite.png",
+		"unknown": "ignored",
+	}), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ee := (spriteInfo{Width: SassNumber{10, "px"}, URL: "sprite.png"}); ee != res {
+		t.Errorf("got: %#v wanted: %#v", res, ee)
+	}
+}
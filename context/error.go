@@ -1,6 +1,7 @@
 package context
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -22,6 +23,67 @@ type SassError struct {
 	File, Message        string
 }
 
+// CompileError is returned when libsass fails to compile the input.
+// File, Line and Column are where libsass found the error.  Partial and
+// PartialLine are the file and line the error came from, they differ
+// from File and Line when the input was assembled from several files
+// and the Context has a LookupPosition.  Lines are the source lines
+// surrounding the error starting at line FirstLine.
+type CompileError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+
+	Partial     string `json:"partial"`
+	PartialLine int    `json:"partial_line"`
+
+	Lines     []string `json:"lines,omitempty"`
+	FirstLine int      `json:"first_line,omitempty"`
+}
+
+func (e *CompileError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Error > %s:%d\n%s\n", e.File, e.Line, e.Message)
+	for _, l := range e.Lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// compileError creates a CompileError from the last libsass error, src
+// is the source of the file the error was found in.
+func (ctx *Context) compileError(src []byte) *CompileError {
+	e := &CompileError{
+		File:        ctx.Errors.File,
+		Line:        ctx.Errors.Line,
+		Column:      ctx.Errors.Column,
+		Message:     ctx.Errors.Message,
+		Partial:     ctx.Errors.File,
+		PartialLine: ctx.Errors.Line,
+	}
+	if e.File == "stdin" && ctx.LookupPosition != nil {
+		if file, line := ctx.LookupPosition(e.Line); file != "" {
+			e.Partial, e.PartialLine = file, line
+		}
+	}
+
+	lines := bytes.Split(src, []byte("\n"))
+	start, end := e.Line-7, e.Line+7
+	if start < 0 {
+		start = 0
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	for i := start; i < end; i++ {
+		e.Lines = append(e.Lines, string(lines[i]))
+	}
+	e.FirstLine = start + 1
+	return e
+}
+
 // ProcessSassError reads the original libsass error and creates helpful debuggin
 // information for debuggin that error.
 func (ctx *Context) ProcessSassError(bs []byte) error {
@@ -2,7 +2,11 @@ package context
 
 import (
 	"bytes"
-
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -22,7 +26,7 @@ func TestErrorBasic(t *testing.T) {
 		t.Error("No error returned")
 	}
 
-	e := ErrorMap{2, "no mixin named invalid-function\nBacktrace:\n\tstdin:2"}
+	e := ErrorMap{2, "no mixin named invalid-function"}
 
 	if e.line != ctx.Errors.Line {
 		t.Errorf("wanted: %d\ngot: %d", e.line, ctx.Errors.Line)
@@ -70,11 +74,7 @@ div {
 		t.Error("No error returned")
 	}
 
-	e := ErrorMap{3, "argument `$map` of `map-get($map, $key)`" + ` must be a map
-Backtrace:
-	stdin:3, in function ` + "`map-get`" + `
-	stdin:3, in function ` + "`uniqueFnName`" + `
-	stdin:6`}
+	e := ErrorMap{3, "argument `$map` of `map-get($map, $key)` must be a map"}
 	if e.line != ctx.Errors.Line {
 		t.Errorf("wanted:\n%d\ngot:\n%d", e.line, ctx.Errors.Line)
 	}
@@ -94,7 +94,7 @@ func TestErrorImport(t *testing.T) {
 	if err == nil {
 		t.Error("No error returned")
 	}
-	e := ErrorMap{2, "file to import not found or unreadable: fail\nCurrent dir: "}
+	e := ErrorMap{2, "File to import not found or unreadable: fail."}
 	if e.line != ctx.Errors.Line {
 		t.Errorf("wanted:\n%d\ngot:\n%d", e.line, ctx.Errors.Line)
 	}
@@ -105,6 +105,77 @@ func TestErrorImport(t *testing.T) {
 
 }
 
+func TestCompileError(t *testing.T) {
+	in := bytes.NewBufferString(`@mixin one {
+  color: red;
+}
+div {
+  color: $blue;
+}`)
+	ctx := Context{
+		LookupPosition: func(line int) (string, int) {
+			if line > 3 {
+				return "main.scss", line - 3
+			}
+			return "_mixins.scss", line
+		},
+	}
+	var out bytes.Buffer
+	err := ctx.Compile(in, &out)
+	var cerr *CompileError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got: %#v wanted: *CompileError", err)
+	}
+	if cerr.File != "stdin" || cerr.Line != 5 {
+		t.Errorf("got: %s:%d wanted: stdin:5", cerr.File, cerr.Line)
+	}
+	if cerr.Partial != "main.scss" || cerr.PartialLine != 2 {
+		t.Errorf("got: %s:%d wanted: main.scss:2", cerr.Partial, cerr.PartialLine)
+	}
+	if e := `Undefined variable: "$blue".`; cerr.Message != e {
+		t.Errorf("got: %s wanted: %s", cerr.Message, e)
+	}
+	e := []string{"@mixin one {", "  color: red;", "}", "div {",
+		"  color: $blue;", "}"}
+	if !reflect.DeepEqual(e, cerr.Lines) || cerr.FirstLine != 1 {
+		t.Errorf("got: %d %q wanted: 1 %q", cerr.FirstLine, cerr.Lines, e)
+	}
+}
+
+func TestCompileErrorPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errpartial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "_bad.scss"), []byte(`p {
+  color: $blue;
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := bytes.NewBufferString(`@import "bad";
+div {
+  color: red;
+}`)
+	ctx := Context{IncludePaths: []string{dir}}
+	var out bytes.Buffer
+	err = ctx.Compile(in, &out)
+	var cerr *CompileError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got: %#v wanted: *CompileError", err)
+	}
+	if filepath.Base(cerr.File) != "_bad.scss" || cerr.Line != 2 {
+		t.Errorf("got: %s:%d wanted: _bad.scss:2", cerr.File, cerr.Line)
+	}
+	// The lines are from the partial, not the input
+	e := []string{"p {", "  color: $blue;", "}"}
+	if !reflect.DeepEqual(e, cerr.Lines) || cerr.FirstLine != 1 {
+		t.Errorf("got: %d %q wanted: 1 %q", cerr.FirstLine, cerr.Lines, e)
+	}
+}
+
 func TestProcessSassError(t *testing.T) {
 	in := []byte(`{
   "status": 1,
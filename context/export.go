@@ -6,9 +6,18 @@ package context
 
 // #cgo pkg-config: --cflags libsass
 // #cgo LDFLAGS: -lsass -lstdc++ -lm
-// #include "sass_context.h"
+// #include <stdlib.h>
+// #include "sass/context.h"
+// #include "sass2scss.h"
 import "C"
-import "unsafe"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+)
 
 // Cookie is used for passing context information to libsass.  Cookie is
 // passed to custom handlers when libsass executes them through the go bridge.
@@ -22,13 +31,156 @@ type Cookie struct {
 // to the interface provided by libsass.
 //
 //export GoBridge
-func GoBridge(cargs UnionSassValue, ptr unsafe.Pointer) UnionSassValue {
+func GoBridge(cargs UnionSassValue, ptr unsafe.Pointer, comp *C.struct_Sass_Compiler) (usv UnionSassValue) {
 	// Recover the Cookie struct passed in
-	ck := *(*Cookie)(ptr)
-	usv := ck.Fn(ck.Ctx, cargs)
+	ck, _ := lookupCookie(ptr).(*Cookie)
+	if ck == nil {
+		return Error(errors.New("unknown function cookie"))
+	}
+	// Stop calling handlers once the compile is cancelled
+	if err := ck.Ctx.Err(); err != nil {
+		return Error(err)
+	}
+	// A panic can not unwind through libsass, fail the compile instead
+	defer func() {
+		if r := recover(); r != nil {
+			usv = Error(handlerPanic(ck.Sign, cargs, r))
+		}
+	}()
+	ck.Ctx.setCallee(comp)
+	usv = ck.Fn(ck.Ctx, cargs)
 	return usv
 }
 
+// handlerPanic describes the panic r of the handler with the signature
+// sign called with args.  It must be called from the deferred function
+// that recovered r.
+func handlerPanic(sign string, args UnionSassValue, r interface{}) error {
+	var inf interface{}
+	Unmarshal(args, &inf)
+	err := fmt.Errorf("panic in %s called with %v: %v", funcName(sign), inf, r)
+
+	// Find the frame that panicked, skipping the runtime and the
+	// deferred function.
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			return fmt.Errorf("%s\n\tat %s (%s:%d)", err, f.Function, f.File, f.Line)
+		}
+		if !more {
+			return err
+		}
+	}
+}
+
+// cookies find the Go values for the cookies libsass passes to the
+// bridges.  Go pointers can not be handed to C, so each cookie is C
+// memory used as a key.
+var cookies = struct {
+	sync.RWMutex
+	m map[unsafe.Pointer]interface{}
+}{m: make(map[unsafe.Pointer]interface{})}
+
+// newCookie registers v for the bridges until release is called.
+func (ctx *Context) newCookie(v interface{}) unsafe.Pointer {
+	ck := C.malloc(1)
+	cookies.Lock()
+	cookies.m[ck] = v
+	cookies.Unlock()
+	ctx.cookies = append(ctx.cookies, ck)
+	return ck
+}
+
+// release removes the cookies created for the last compile.
+func (ctx *Context) release() {
+	cookies.Lock()
+	for _, ck := range ctx.cookies {
+		delete(cookies.m, ck)
+		C.free(ck)
+	}
+	cookies.Unlock()
+	ctx.cookies = nil
+	ctx.cookie = nil
+}
+
+func lookupCookie(ck unsafe.Pointer) interface{} {
+	cookies.RLock()
+	defer cookies.RUnlock()
+	return cookies.m[ck]
+}
+
+// ImportBridge is exported to C for resolving @import with the
+// Importers of the Context passed in ptr.  Returning nil lets libsass
+// load the file.
+//
+//export ImportBridge
+func ImportBridge(url, prev *C.char, ptr unsafe.Pointer) C.Sass_Import_List {
+	ctx := importContext(ptr)
+	if ctx == nil {
+		return nil
+	}
+	// Stop importing once the compile is cancelled
+	var path string
+	var contents []byte
+	err := ctx.Err()
+	if err == nil {
+		path, contents, err = ctx.resolveImport(C.GoString(url), C.GoString(prev))
+	}
+	if err == ErrSkipImport {
+		return nil
+	}
+	list := C.sass_make_import_list(1)
+	if err != nil {
+		entry := C.sass_make_import_entry(url, nil, nil)
+		msg := C.CString(err.Error())
+		defer C.free(unsafe.Pointer(msg))
+		C.sass_import_set_error(entry, msg, 0, 0)
+		C.sass_import_set_list_entry(list, 0, entry)
+		return list
+	}
+	if Indented(path) {
+		// libsass only converts the files it reads itself
+		contents = ToSCSS(contents)
+	}
+	// libsass copies the path and takes ownership of the source
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	entry := C.sass_make_import_entry(cpath, C.CString(string(contents)), nil)
+	C.sass_import_set_list_entry(list, 0, entry)
+	return list
+}
+
+// ToSCSS converts src from the indented Sass syntax to SCSS.
+func ToSCSS(src []byte) []byte {
+	in := C.CString(string(src))
+	defer C.free(unsafe.Pointer(in))
+	out := C.sass2scss(in, C.SASS2SCSS_PRETTIFY_1|C.SASS2SCSS_KEEP_COMMENT)
+	defer C.free(unsafe.Pointer(out))
+	return []byte(C.GoString(out))
+}
+
+// HeaderBridge is exported to C for loading the headers of the Context
+// passed in ptr before the input.
+//
+//export HeaderBridge
+func HeaderBridge(url, prev *C.char, ptr unsafe.Pointer) C.Sass_Import_List {
+	ctx := importContext(ptr)
+	if ctx == nil || len(ctx.headers) == 0 {
+		return nil
+	}
+	list := C.sass_make_import_list(C.size_t(len(ctx.headers)))
+	for i, h := range ctx.headers {
+		// libsass copies the path and takes ownership of the source
+		path := C.CString(h.name)
+		entry := C.sass_make_import_entry(path, C.CString(h.src), nil)
+		C.free(unsafe.Pointer(path))
+		C.sass_import_set_list_entry(list, C.size_t(i), entry)
+	}
+	return list
+}
+
 // CookieCb defines the callback libsass eventually executes in sprite_sass
 type SassCallback func(ctx *Context, csv UnionSassValue) UnionSassValue
 
@@ -37,9 +189,6 @@ type handler struct {
 	callback func(ctx *Context, csv UnionSassValue) UnionSassValue
 }
 
-// handlers is the list of registered sass handlers
-var handlers []handler
-
 func SampleCB(ctx *Context, usv UnionSassValue) UnionSassValue {
 	var sv []interface{}
 	Unmarshal(usv, &sv)
@@ -50,9 +199,15 @@ func Error(err error) UnionSassValue {
 	return C.sass_make_error(C.CString(err.Error()))
 }
 
-// RegisterHandler sets the passed signature and callback to the
-// handlers array.
+// RegisterHandler adds the passed signature and callback to
+// DefaultRegistry.
 func RegisterHandler(sign string,
 	callback func(ctx *Context, csv UnionSassValue) UnionSassValue) {
-	handlers = append(handlers, handler{sign, callback})
+	DefaultRegistry.Register(sign, callback)
+}
+
+// RegisterHeader adds the Sass src as the header name to
+// DefaultRegistry.
+func RegisterHeader(name, src string) {
+	DefaultRegistry.RegisterHeader(name, src)
 }
@@ -1,6 +1,10 @@
 package context
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
 
 func TestSampleCB(t *testing.T) {
 	ctx := NewContext()
@@ -20,3 +24,29 @@ func TestSampleCB(t *testing.T) {
 		t.Errorf("wanted: %t got: %t", e, b)
 	}
 }
+
+func TestGoBridgePanic(t *testing.T) {
+	in := bytes.NewBufferString(`div {
+  width: boom(1px, a);
+}`)
+
+	ctx := Context{}
+	ctx.Cookies = []Cookie{{
+		"boom($a, $b)", func(c *Context, usv UnionSassValue) UnionSassValue {
+			var infs []interface{}
+			Unmarshal(usv, &infs)
+			_ = infs[0].(string)
+			return usv
+		}, &ctx,
+	}}
+	var out bytes.Buffer
+	err := ctx.Compile(in, &out)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, e := range []string{"panic in boom called with", "export_test.go"} {
+		if !strings.Contains(ctx.Errors.Message, e) {
+			t.Errorf("%q not found in:\n%s", e, ctx.Errors.Message)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package context
+
+// #include "sass/context.h"
+import "C"
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"strings"
+)
+
+var (
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterFunc adds the Go function fn as the Sass function name to
+// DefaultRegistry, see Registry.RegisterFunc.
+func RegisterFunc(name string, fn interface{}) error {
+	return DefaultRegistry.RegisterFunc(name, fn)
+}
+
+// RegisterFunc adds the Go function fn as the Sass function name.  The
+// Sass signature is derived from the parameters of fn, the arguments
+// are unmarshalled into them and the result is marshalled back to Sass.
+// fn may take the *Context as its first parameter and return a value,
+// an error or both, ie.
+//
+//	func(path string, spacing SassNumber) (string, error)
+//
+// is called from Sass as name($arg1, $arg2).  A non-nil error is
+// returned to libsass as a Sass error.
+func (r *Registry) RegisterFunc(name string, fn interface{}) error {
+	sign, cb, err := reflectFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	r.Register(sign, cb)
+	return nil
+}
+
+// reflectFunc creates the Sass signature and callback for fn.
+func reflectFunc(name string, fn interface{}) (string, SassCallback, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return "", nil, fmt.Errorf("%s: %T is not a function", name, fn)
+	}
+	t := v.Type()
+	if t.IsVariadic() {
+		return "", nil, fmt.Errorf("%s: variadic functions are not supported", name)
+	}
+	if name == "" || strings.ContainsAny(name, "($) ") {
+		return "", nil, fmt.Errorf("invalid function name %q", name)
+	}
+
+	withCtx := t.NumIn() > 0 && t.In(0) == contextType
+	first := 0
+	if withCtx {
+		first = 1
+	}
+	var params []string
+	for i := first; i < t.NumIn(); i++ {
+		if !sassType(t.In(i)) {
+			return "", nil, fmt.Errorf("%s: parameter type %s is not supported",
+				name, t.In(i))
+		}
+		params = append(params, fmt.Sprintf("$arg%d", len(params)+1))
+	}
+
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		if t.Out(0) != errorType && !sassType(t.Out(0)) {
+			return "", nil, fmt.Errorf("%s: result type %s is not supported",
+				name, t.Out(0))
+		}
+	case 2:
+		if !sassType(t.Out(0)) || t.Out(1) != errorType {
+			return "", nil, fmt.Errorf("%s: results must be (value, error)", name)
+		}
+	default:
+		return "", nil, fmt.Errorf("%s: too many results", name)
+	}
+
+	cb := func(ctx *Context, usv UnionSassValue) UnionSassValue {
+		in := make([]reflect.Value, t.NumIn())
+		if withCtx {
+			in[0] = reflect.ValueOf(ctx)
+		}
+		n := int(C.sass_list_get_length(usv))
+		for i := first; i < len(in); i++ {
+			arg := reflect.New(t.In(i))
+			if i-first < n {
+				err := unmarshal(C.sass_list_get_value(usv, C.size_t(i-first)),
+					arg.Interface())
+				if err != nil {
+					return Error(fmt.Errorf("%s: $arg%d: %s", name, i-first+1, err))
+				}
+			}
+			in[i] = arg.Elem()
+		}
+
+		out := v.Call(in)
+		if len(out) > 0 && t.Out(len(out)-1) == errorType {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return Error(err)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return C.sass_make_null()
+		}
+		res, err := Marshal(out[0].Interface())
+		if err != nil {
+			return Error(err)
+		}
+		return res
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(params, ", ")), cb, nil
+}
+
+// sassTypes are the Go types Marshal and Unmarshal convert, slices of
+// them are lists and maps of them with string keys or structs are maps.
+var sassTypes = map[reflect.Type]bool{
+	reflect.TypeOf(""):                         true,
+	reflect.TypeOf(false):                      true,
+	reflect.TypeOf(SassNumber{}):               true,
+	reflect.TypeOf(color.RGBA{}):               true,
+	reflect.TypeOf((*interface{})(nil)).Elem(): true,
+}
+
+// sassType reports whether values of t can be passed to and from Sass.
+func sassType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice:
+		return sassType(t.Elem())
+	case reflect.Map:
+		return t.Key() == reflect.TypeOf("") && sassType(t.Elem())
+	case reflect.Struct:
+		// Other structs are Sass maps of their fields
+		return sassTypes[t] || len(structFields(t)) > 0
+	}
+	return sassTypes[t]
+}
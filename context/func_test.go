@@ -0,0 +1,88 @@
+package context
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	r := NewRegistry()
+	err := r.RegisterFunc("double", func(n SassNumber) SassNumber {
+		return SassNumber{Value: n.Value * 2, Unit: n.Unit}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.RegisterFunc("pick", func(ctx *Context, names []string, name string) (string, error) {
+		if ctx == nil {
+			return "", errors.New("no context")
+		}
+		for _, n := range names {
+			if n == name {
+				return n, nil
+			}
+		}
+		return "", errors.New(name + " not found")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sign, _, _ := r.Lookup("pick"); sign != "pick($arg1, $arg2)" {
+		t.Errorf("got: %s wanted: pick($arg1, $arg2)", sign)
+	}
+
+	in := bytes.NewBufferString(`div {
+  width: double(3px);
+  content: pick((a, b, c), b);
+}`)
+	var out bytes.Buffer
+	ctx := Context{Funcs: r}
+	err = ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  width: 6px;
+  content: b; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+
+	out.Reset()
+	err = ctx.Compile(bytes.NewBufferString(`div {
+  content: pick((a, b), z);
+}`), &out)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if e := "z not found"; !strings.Contains(ctx.Errors.Message, e) {
+		t.Errorf("got: %s wanted: %s", ctx.Errors.Message, e)
+	}
+}
+
+func TestRegisterFuncInvalid(t *testing.T) {
+	r := NewRegistry()
+	fns := map[string]interface{}{
+		"notfunc":  "foo",
+		"nil":      nil,
+		"nilfunc":  (func(string))(nil),
+		"variadic": func(s ...string) {},
+		"param":    func(i int) {},
+		"result":   func() int { return 0 },
+		"results":  func() (string, string) { return "", "" },
+	}
+	for name, fn := range fns {
+		if err := r.RegisterFunc(name, fn); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := r.RegisterFunc("bad name()", func() {}); err == nil {
+		t.Error("invalid name was accepted")
+	}
+	if names := r.Names(); len(names) != 0 {
+		t.Errorf("functions were registered: %v", names)
+	}
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	gocontext "context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 
 	sw "github.com/wellington/spritewell"
 	cx "github.com/wellington/wellington/context"
@@ -21,8 +29,17 @@ func init() {
 	cx.RegisterHandler("inline-image($path)", InlineImage)
 	cx.RegisterHandler("font-url($path, $raw: false)", FontURL)
 	cx.RegisterHandler("sprite($map, $name, $offsetX: 0px, $offsetY: 0px)", Sprite)
+	cx.RegisterHeader("sprite-mixins", spriteMixins)
 }
 
+// spriteMixins are loaded before every input.
+const spriteMixins = `@mixin sprite-dimensions($map, $name) {
+  $file: sprite-file($map, $name);
+  height: image-height($file);
+  width: image-width($file);
+}
+`
+
 // ImageURL handles calls to resolve a local image from the
 // built css file path.
 func ImageURL(ctx *cx.Context, csv cx.UnionSassValue) cx.UnionSassValue {
@@ -32,6 +49,7 @@ func ImageURL(ctx *cx.Context, csv cx.UnionSassValue) cx.UnionSassValue {
 	if err != nil {
 		return cx.Error(err)
 	}
+	ctx.IncludeFile(filepath.Join(ctx.ImageDir, path[0]))
 	url := filepath.Join(ctx.RelativeImage(), path[0])
 	res, err := cx.Marshal(fmt.Sprintf("url('%s')", url))
 	if err != nil {
@@ -70,20 +88,25 @@ func ImageHeight(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 		GenImgDir: ctx.GenImgDir,
 	}
 	if glob == "" {
-		if hit, ok := ctx.Imgs.M[name]; ok {
+		key := cacheKey(ctx, name)
+		ctx.Imgs.RLock()
+		hit, ok := ctx.Imgs.M[key]
+		ctx.Imgs.RUnlock()
+		if ok {
 			imgs = hit
 		} else {
 			imgs.Decode(name)
 			imgs.Combine()
 			ctx.Imgs.Lock()
-			ctx.Imgs.M[name] = imgs
+			ctx.Imgs.M[key] = imgs
 			ctx.Imgs.Unlock()
 		}
 	} else {
 		ctx.Sprites.RLock()
-		imgs = ctx.Sprites.M[glob]
+		imgs = ctx.Sprites.M[cacheKey(ctx, glob)]
 		ctx.Sprites.RUnlock()
 	}
+	ctx.IncludeFile(imgs.Paths...)
 	height := imgs.SImageHeight(name)
 	Hheight := cx.SassNumber{
 		Value: float64(height),
@@ -91,7 +114,7 @@ func ImageHeight(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	}
 	res, err := cx.Marshal(Hheight)
 	if err != nil {
-		fmt.Println(err)
+		return cx.Error(err)
 	}
 	return res
 }
@@ -125,20 +148,25 @@ func ImageWidth(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 		GenImgDir: ctx.GenImgDir,
 	}
 	if glob == "" {
-		if hit, ok := ctx.Imgs.M[name]; ok {
+		key := cacheKey(ctx, name)
+		ctx.Imgs.RLock()
+		hit, ok := ctx.Imgs.M[key]
+		ctx.Imgs.RUnlock()
+		if ok {
 			imgs = hit
 		} else {
 			imgs.Decode(name)
 			imgs.Combine()
 			ctx.Imgs.Lock()
-			ctx.Imgs.M[name] = imgs
+			ctx.Imgs.M[key] = imgs
 			ctx.Imgs.Unlock()
 		}
 	} else {
 		ctx.Sprites.RLock()
-		imgs = ctx.Sprites.M[glob]
+		imgs = ctx.Sprites.M[cacheKey(ctx, glob)]
 		ctx.Sprites.RUnlock()
 	}
+	ctx.IncludeFile(imgs.Paths...)
 	v := imgs.SImageWidth(name)
 	vv := cx.SassNumber{
 		Value: float64(v),
@@ -146,7 +174,7 @@ func ImageWidth(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	}
 	res, err := cx.Marshal(vv)
 	if err != nil {
-		fmt.Println(err)
+		return cx.Error(err)
 	}
 	return res
 }
@@ -158,14 +186,13 @@ func InlineImage(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	)
 	err := cx.Unmarshal(usv, &name)
 	if err != nil {
-		fmt.Println(err)
+		return cx.Error(err)
 	}
 
 	if !sw.CanDecode(filepath.Ext(name)) {
 		s := fmt.Sprintf("inline-image: %s filetype %s is not supported",
 			name, filepath.Ext(name))
-		fmt.Println(s)
-		// TODO: Replace with warning
+		ctx.Warn(cx.Warning{Message: s})
 		res, _ := cx.Marshal(s)
 		return res
 	}
@@ -179,14 +206,15 @@ func InlineImage(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	if err != nil {
 		return cx.Error(err)
 	}
+	ctx.IncludeFile(imgs.Paths...)
 	_, err = imgs.Combine()
 	if err != nil {
-		fmt.Println(err)
+		return cx.Error(err)
 	}
 	str := imgs.Inline()
 	res, err := cx.Marshal(str)
 	if err != nil {
-		fmt.Println(err)
+		return cx.Error(err)
 	}
 	return res
 }
@@ -219,7 +247,7 @@ func Sprite(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	}
 	ctx.Sprites.RLock()
 	defer ctx.Sprites.RUnlock()
-	imgs, ok := ctx.Sprites.M[glob]
+	imgs, ok := ctx.Sprites.M[cacheKey(ctx, glob)]
 	if !ok {
 		keys := make([]string, 0, len(ctx.Sprites.M))
 		for i := range ctx.Sprites.M {
@@ -274,13 +302,16 @@ func SpriteMap(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 		glob = cglob
 	}
 
-	key := glob + strconv.FormatInt(int64(spacing.Value), 10)
+	name := glob + strconv.FormatInt(int64(spacing.Value), 10)
+	key := cacheKey(ctx, name)
 	// TODO: benchmark a single write lock against this
 	// read lock then write lock
 	ctx.Sprites.RLock()
-	if _, ok := ctx.Sprites.M[key]; ok {
+	if hit, ok := ctx.Sprites.M[key]; ok {
 		ctx.Sprites.RUnlock()
-		res, err := cx.Marshal(key)
+		ctx.IncludeFile(hit.Paths...)
+		ctx.IncludeSprite(key)
+		res, err := cx.Marshal(name)
 		if err != nil {
 			return cx.Error(err)
 		}
@@ -288,30 +319,242 @@ func SpriteMap(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	}
 	ctx.Sprites.RUnlock()
 
-	err = imgs.Decode(glob)
+	err = generateSprite(ctx.Sprites, key, func() (sw.ImageList, error) {
+		var res sw.ImageList
+		err := cancellable(ctx, func() error {
+			imgs := imgs
+			stamp := spriteStamp(ctx, imgs, glob)
+			if hit, ok := stamp.load(imgs); ok {
+				res = hit
+				return nil
+			}
+			err := imgs.Decode(glob)
+			if err != nil {
+				return err
+			}
+			_, err = imgs.Combine()
+			if err != nil {
+				return err
+			}
+			// The compile may have given up while decoding, leave
+			// the files of a previous sprite alone.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			_, err = imgs.Export()
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			res = imgs
+			return stamp.save(imgs)
+		})
+		if err != nil {
+			return sw.ImageList{}, err
+		}
+		return res, nil
+	})
 	if err != nil {
 		return cx.Error(err)
 	}
-	gpath, err := imgs.Combine()
-	_ = gpath
+	ctx.Sprites.RLock()
+	ctx.IncludeFile(ctx.Sprites.M[key].Paths...)
+	ctx.Sprites.RUnlock()
+	ctx.IncludeSprite(key)
+
+	res, err := cx.Marshal(name)
 	if err != nil {
 		return cx.Error(err)
 	}
 
-	_, err = imgs.Export()
+	return res
+}
+
+// cacheKey is the key in the sprite and image caches of name, which is
+// found in the image directory of ctx.  The caches are shared by
+// entries that use different image directories.
+func cacheKey(ctx *cx.Context, name string) string {
+	return filepath.Join(ctx.ImageDir, name)
+}
+
+// cancellable runs fn, returning early if the compile is cancelled.
+// Decoding a large glob can not be interrupted, so fn is left to
+// finish in the background and must not share state with the caller.
+// fn should check ctx.Err before writing files.
+func cancellable(ctx *cx.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stamp records the checksum of the images in a sprite and their sizes,
+// so an unchanged sprite is used without decoding its images.
+type stamp struct {
+	path, glob, output string
+
+	Sum   string        `json:"sum"`
+	Paths []string      `json:"paths"`
+	Sizes []image.Point `json:"sizes"`
+}
+
+// spriteStamp checksums the images matching glob and the padding of
+// imgs.  The stamp is empty if ctx.CacheDir is not set.
+func spriteStamp(ctx *cx.Context, imgs sw.ImageList, glob string) stamp {
+	if ctx.CacheDir == "" {
+		return stamp{}
+	}
+	paths, err := filepath.Glob(filepath.Join(imgs.ImageDir, glob))
+	if err != nil || len(paths) == 0 {
+		return stamp{}
+	}
+	imgs.Globs = []string{glob}
+	imgs.Paths = paths
+	out, err := imgs.OutputPath()
 	if err != nil {
-		return cx.Error(err)
+		return stamp{}
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%d\n", imgs.Padding)
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return stamp{}
+		}
+		fmt.Fprintf(h, "%s\n", path)
+		h.Write(bs)
+	}
+	return stamp{
+		path:   filepath.Join(ctx.CacheDir, "sprites", filepath.Base(out)+".json"),
+		glob:   glob,
+		output: filepath.Join(ctx.GenImgDir, out),
+		Sum:    hex.EncodeToString(h.Sum(nil)),
+		Paths:  paths,
 	}
+}
 
-	res, err := cx.Marshal(key)
-	ctx.Sprites.Lock()
-	ctx.Sprites.M[key] = imgs
-	ctx.Sprites.Unlock()
+// load returns imgs laid out as the sprite saved with the same images.
+// Only the sizes of the images are known, they are not decoded.
+func (s stamp) load(imgs sw.ImageList) (sw.ImageList, bool) {
+	if s.path == "" {
+		return imgs, false
+	}
+	if _, err := os.Stat(s.output); err != nil {
+		return imgs, false
+	}
+	bs, err := ioutil.ReadFile(s.path)
 	if err != nil {
-		return cx.Error(err)
+		return imgs, false
 	}
+	var saved stamp
+	err = json.Unmarshal(bs, &saved)
+	if err != nil || saved.Sum != s.Sum || len(saved.Sizes) != len(s.Paths) {
+		return imgs, false
+	}
+	imgs.Globs = []string{s.glob}
+	imgs.Paths = s.Paths
+	imgs.GoImages = make(sw.GoImages, len(saved.Sizes))
+	for i, size := range saved.Sizes {
+		imgs.GoImages[i] = image.Rectangle{Max: size}
+	}
+	return imgs, true
+}
 
-	return res
+// save records the sizes of the images exported to the sprite.
+func (s stamp) save(imgs sw.ImageList) error {
+	if s.path == "" {
+		return nil
+	}
+	s.Sizes = make([]image.Point, len(imgs.GoImages))
+	for i, img := range imgs.GoImages {
+		s.Sizes[i] = img.Bounds().Size()
+	}
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, bs, 0644)
+}
+
+// spriteCall is a sprite being generated by SpriteMap.
+type spriteCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+var (
+	spriteMu sync.Mutex
+	// spriteCalls holds the sprites currently being generated
+	spriteCalls = make(map[string]*spriteCall)
+)
+
+// generateSprite runs fn and saves the resulting sprite in cache.
+// Concurrent calls for the same cache and key wait for the first
+// call to finish instead of generating the sprite again.  When the
+// first call was cancelled, the calls waiting for it try again.
+func generateSprite(cache *sw.SafeImageMap, key string,
+	fn func() (sw.ImageList, error)) error {
+	id := fmt.Sprintf("%p:%s", cache, key)
+
+	spriteMu.Lock()
+	for {
+		c, ok := spriteCalls[id]
+		if !ok {
+			break
+		}
+		spriteMu.Unlock()
+		c.wg.Wait()
+		if !cancelled(c.err) {
+			return c.err
+		}
+		spriteMu.Lock()
+	}
+	// The sprite may have been finished since the caller checked
+	cache.RLock()
+	_, ok := cache.M[key]
+	cache.RUnlock()
+	if ok {
+		spriteMu.Unlock()
+		return nil
+	}
+	c := &spriteCall{}
+	c.wg.Add(1)
+	spriteCalls[id] = c
+	spriteMu.Unlock()
+
+	imgs, err := fn()
+	if err == nil {
+		cache.Lock()
+		cache.M[key] = imgs
+		cache.Unlock()
+	}
+	c.err = err
+
+	spriteMu.Lock()
+	delete(spriteCalls, id)
+	spriteMu.Unlock()
+	c.wg.Done()
+	return err
+}
+
+// cancelled reports whether err is the error of a cancelled compile.
+func cancelled(err error) bool {
+	return err == gocontext.Canceled || err == gocontext.DeadlineExceeded
 }
 
 // FontURL builds a relative path to the requested font file from the built CSS.
@@ -331,11 +574,12 @@ func FontURL(ctx *cx.Context, usv cx.UnionSassValue) cx.UnionSassValue {
 	// Enter warning
 	if ctx.FontDir == "." || ctx.FontDir == "" {
 		s := "font-url: font path not set"
-		fmt.Println(s)
+		ctx.Warn(cx.Warning{Message: s})
 		res, _ := cx.Marshal(s)
 		return res
 	}
 
+	ctx.IncludeFile(filepath.Join(ctx.FontDir, path))
 	rel, err := filepath.Rel(ctx.BuildDir, ctx.FontDir)
 
 	if err != nil {
@@ -2,10 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	gocontext "context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/wellington/spritewell"
 	cx "github.com/wellington/wellington/context"
@@ -124,6 +131,214 @@ func TestFuncSpriteMap(t *testing.T) {
 	}
 }
 
+func TestGenerateSpriteOnce(t *testing.T) {
+	cache := &spritewell.SafeImageMap{
+		M: make(map[string]spritewell.ImageList)}
+	var calls int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			err := generateSprite(cache, "*.png0", func() (spritewell.ImageList, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return spritewell.ImageList{}, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if e := int32(1); calls != e {
+		t.Errorf("got: %d wanted: %d", calls, e)
+	}
+	if _, ok := cache.M["*.png0"]; !ok {
+		t.Error("sprite was not saved to the cache")
+	}
+}
+
+func TestGenerateSpriteCancelled(t *testing.T) {
+	cache := &spritewell.SafeImageMap{
+		M: make(map[string]spritewell.ImageList)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- generateSprite(cache, "*.png0", func() (spritewell.ImageList, error) {
+			close(started)
+			<-release
+			return spritewell.ImageList{}, gocontext.Canceled
+		})
+	}()
+	<-started
+
+	second := make(chan error, 1)
+	var calls int32
+	go func() {
+		second <- generateSprite(cache, "*.png0", func() (spritewell.ImageList, error) {
+			atomic.AddInt32(&calls, 1)
+			return spritewell.ImageList{}, nil
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if err := <-first; err != gocontext.Canceled {
+		t.Errorf("got: %v wanted: %v", err, gocontext.Canceled)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("cancellation was shared: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("waiting call ran %d times", calls)
+	}
+	if _, ok := cache.M["*.png0"]; !ok {
+		t.Error("sprite was not saved to the cache")
+	}
+}
+
+func TestSpriteStamp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	imgDir := filepath.Join(dir, "img")
+	os.Mkdir(imgDir, 0755)
+	for _, name := range []string{"139.png", "140.png"} {
+		bs, err := ioutil.ReadFile(filepath.Join("../test/img/dual", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.WriteFile(filepath.Join(imgDir, name), bs, 0644)
+	}
+
+	ctx := cx.NewContext()
+	ctx.ImageDir = imgDir
+	ctx.GenImgDir = dir
+	ctx.CacheDir = filepath.Join(dir, "cache")
+	imgs := spritewell.ImageList{
+		ImageDir:  ctx.ImageDir,
+		GenImgDir: ctx.GenImgDir,
+		Padding:   10,
+	}
+
+	s := spriteStamp(ctx, imgs, "*.png")
+	if _, ok := s.load(imgs); ok {
+		t.Error("sprite was fresh before it was exported")
+	}
+	decoded := imgs
+	err = decoded.Decode("*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(s.output, nil, 0644)
+	err = s.save(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit, ok := spriteStamp(ctx, imgs, "*.png").load(imgs)
+	if !ok {
+		t.Fatal("unchanged sprite was not fresh")
+	}
+	for _, name := range []string{"139", "140"} {
+		pos := decoded.Lookup(name)
+		if hit.Lookup(name) != pos {
+			t.Errorf("%s: got: %d wanted: %d", name, hit.Lookup(name), pos)
+		}
+		if hit.GetPack(pos) != decoded.GetPack(pos) {
+			t.Errorf("%s: got: %v wanted: %v", name,
+				hit.GetPack(pos), decoded.GetPack(pos))
+		}
+		if hit.SImageHeight(name) != decoded.SImageHeight(name) {
+			t.Errorf("%s: got: %d wanted: %d", name,
+				hit.SImageHeight(name), decoded.SImageHeight(name))
+		}
+	}
+
+	added := filepath.Join(imgDir, "141.png")
+	ioutil.WriteFile(added, nil, 0644)
+	if _, ok := spriteStamp(ctx, imgs, "*.png").load(imgs); ok {
+		t.Error("sprite was fresh after an image was added")
+	}
+	os.Remove(added)
+
+	f, _ := os.OpenFile(filepath.Join(imgDir, "140.png"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0})
+	f.Close()
+	if _, ok := spriteStamp(ctx, imgs, "*.png").load(imgs); ok {
+		t.Error("sprite was fresh after an image changed")
+	}
+
+	ctx.CacheDir = ""
+	if _, ok := spriteStamp(ctx, imgs, "*.png").load(imgs); ok {
+		t.Error("sprite was fresh without a cache directory")
+	}
+}
+
+func TestSpriteSharedCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Both image directories have icons/x.png, in different sizes
+	srcs := map[string]string{
+		"a": "../test/img/139.png",
+		"b": "../test/img/pixel/1x1.png",
+	}
+	for sub, src := range srcs {
+		bs, err := ioutil.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		icons := filepath.Join(dir, sub, "icons")
+		os.MkdirAll(icons, 0755)
+		ioutil.WriteFile(filepath.Join(icons, "x.png"), bs, 0644)
+	}
+
+	in := `$map: sprite-map("icons/*.png");
+div {
+  width: image-width(sprite-file($map, "x"));
+  height: image-height("icons/x.png");
+}`
+	sprites := &spritewell.SafeImageMap{
+		M: make(map[string]spritewell.ImageList)}
+	imgs := &spritewell.SafeImageMap{
+		M: make(map[string]spritewell.ImageList)}
+	exps := map[string]string{
+		"a": `div {
+  width: 96px;
+  height: 139px; }
+`,
+		"b": `div {
+  width: 1px;
+  height: 1px; }
+`,
+	}
+	for _, sub := range []string{"a", "b"} {
+		ctx := cx.NewContext()
+		ctx.Sprites, ctx.Imgs = sprites, imgs
+		ctx.BuildDir = dir
+		ctx.GenImgDir = dir
+		ctx.ImageDir = filepath.Join(dir, sub)
+		var out bytes.Buffer
+		err := ctx.Compile(bytes.NewBufferString(in), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := exps[sub]; e != out.String() {
+			t.Errorf("%s got:\n%s\nwanted:\n%s", sub, out.String(), e)
+		}
+	}
+}
+
 func TestFuncSpriteFile(t *testing.T) {
 	ctx := cx.NewContext()
 	ctx.BuildDir = "../test/build"
@@ -279,6 +494,45 @@ div {
 	}
 }
 
+func TestRegSpriteDimensions(t *testing.T) {
+	in := bytes.NewBufferString(`$map: sprite-map("*.png");
+div {
+  @include sprite-dimensions($map, "139");
+}`)
+	var out bytes.Buffer
+	_, _, err := setupCtx(in, &out)
+	if err != nil {
+		t.Error(err)
+	}
+	e := `div {
+  height: 139px;
+  width: 96px; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+}
+
+func TestIncludedFiles(t *testing.T) {
+	in := bytes.NewBufferString(`$map: sprite-map("dual/*.png");
+div {
+  height: image-height(sprite-file($map, "139"));
+  src: font-url("arial.eot");
+}`)
+	var out bytes.Buffer
+	ctx, _, err := setupCtx(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every image of the sprite is included, the sprite-mixins header
+	// is not a file
+	e := []string{"../test/img/dual/139.png", "../test/img/dual/140.png",
+		"../test/font/arial.eot"}
+	if !reflect.DeepEqual(e, ctx.IncludedFiles()) {
+		t.Errorf("got: %v wanted: %v", ctx.IncludedFiles(), e)
+	}
+}
+
 func TestRegImageURL(t *testing.T) {
 	in := bytes.NewBufferString(`
 div {
@@ -325,7 +579,7 @@ div {
     background: inline-image("image.svg");
 }`)
 	var out bytes.Buffer
-	_, _, err := setupCtx(in, &out)
+	ctx, _, err := setupCtx(in, &out)
 	if err != nil {
 		t.Error(err)
 	}
@@ -335,38 +589,34 @@ div {
 	if e != out.String() {
 		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
 	}
+	if len(ctx.Warnings) != 1 {
+		t.Errorf("got: %v wanted one warning", ctx.Warnings)
+	}
 }
 
 func TestFontURLFail(t *testing.T) {
-	r, w, _ := os.Pipe()
-	old := os.Stdout
-	defer func() { os.Stdout = old }()
-	os.Stdout = w
 	in := bytes.NewBufferString(`@font-face {
   src: font-url("arial.eot");
 }`)
 	var out bytes.Buffer
 	ctx := cx.Context{}
+	var warned []cx.Warning
+	ctx.OnWarning = func(w cx.Warning) {
+		warned = append(warned, w)
+	}
 	err := ctx.Compile(in, &out)
 
 	if err != nil {
 		t.Error(err)
 	}
 
-	outC := make(chan string)
-	go func(r *os.File) {
-		var buf bytes.Buffer
-		io.Copy(&buf, r)
-		outC <- buf.String()
-	}(r)
-
-	w.Close()
-	stdout := <-outC
-
-	if e := "font-url: font path not set\n"; e != stdout {
-		t.Errorf("got:\n%s\nwanted:\n%s\n", stdout, e)
+	e := []cx.Warning{{File: "stdin", Line: 2, Message: "font-url: font path not set"}}
+	if !reflect.DeepEqual(e, ctx.Warnings) {
+		t.Errorf("got:\n%v\nwanted:\n%v\n", ctx.Warnings, e)
+	}
+	if !reflect.DeepEqual(e, warned) {
+		t.Errorf("OnWarning got:\n%v\nwanted:\n%v\n", warned, e)
 	}
-
 }
 
 func ExampleFontURL() {
@@ -431,9 +681,6 @@ div {
 
 	e := `Error > stdin:4
 error in C function sprite: Please specify unit for offset ie. (2px)
-Backtrace:
-	stdin:4, in function ` + "`sprite`" + `
-	stdin:4
 
 $map: sprite-map("dual/*.png", 10px);
 div {
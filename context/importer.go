@@ -0,0 +1,59 @@
+package context
+
+// #include "sass/context.h"
+import "C"
+
+import (
+	"errors"
+	"path/filepath"
+	"unsafe"
+)
+
+// ErrSkipImport is returned by an ImportFunc to pass the import to the
+// next importer.  When every importer skips, libsass loads the file.
+var ErrSkipImport = errors.New("skip import")
+
+// ImportFunc resolves the @import of url from the file prev.  It
+// returns the path of the imported file and its contents.  prev is
+// "stdin" when the import is in the input passed to Compile.  Contents
+// are read as the indented syntax when the path ends in .sass.
+type ImportFunc func(ctx *Context, url, prev string) (string, []byte, error)
+
+// importCookie registers ctx for ImportBridge and HeaderBridge.
+func (ctx *Context) importCookie() unsafe.Pointer {
+	if ctx.cookie == nil {
+		ctx.cookie = ctx.newCookie(ctx)
+	}
+	return ctx.cookie
+}
+
+func importContext(ck unsafe.Pointer) *Context {
+	ctx, _ := lookupCookie(ck).(*Context)
+	return ctx
+}
+
+// importerList creates the single importer list libsass expects for
+// importers and headers, libsass owns the list.
+func importerList(fn C.Sass_Importer_Fn, ck unsafe.Pointer) C.Sass_Importer_List {
+	list := C.sass_make_importer_list(1)
+	C.sass_importer_set_list_entry(list, 0, C.sass_make_importer(fn, 0, ck))
+	return list
+}
+
+// resolveImport tries each of the Importers of ctx in order.
+func (ctx *Context) resolveImport(url, prev string) (string, []byte, error) {
+	for _, fn := range ctx.Importers {
+		path, contents, err := fn(ctx, url, prev)
+		if err == ErrSkipImport {
+			continue
+		}
+		return path, contents, err
+	}
+	return "", nil, ErrSkipImport
+}
+
+// Indented reports whether the file at path is written in the indented
+// Sass syntax.
+func Indented(path string) bool {
+	return filepath.Ext(path) == ".sass"
+}
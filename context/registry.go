@@ -0,0 +1,168 @@
+package context
+
+import (
+	"strings"
+	"sync"
+)
+
+// Registry is a set of Go functions that can be called from Sass.
+// Functions are known by the name in their signature, registering a
+// name again replaces the function.  A Registry also holds headers,
+// Sass libraries like mixins that are loaded before the input.
+type Registry struct {
+	mu      sync.RWMutex
+	funcs   []handler
+	headers []header
+}
+
+// header is a named Sass library passed to libsass as a header.
+type header struct {
+	name, src string
+}
+
+// DefaultRegistry holds the functions added with RegisterHandler and
+// the headers added with RegisterHeader.  It is used by every Context
+// that does not set Funcs.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns a Registry with the functions of each of rs.
+// Functions in later registries replace those of the same name in
+// earlier ones, ie. NewRegistry(DefaultRegistry, site).
+func NewRegistry(rs ...*Registry) *Registry {
+	r := &Registry{}
+	for _, o := range rs {
+		r.Include(o)
+	}
+	return r
+}
+
+// Register adds fn with the Sass signature sign, ie.
+// "sprite-map($glob, $spacing: 0px)".  A function with the same name
+// is replaced.
+func (r *Registry) Register(sign string, fn SassCallback) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(handler{sign, fn})
+}
+
+func (r *Registry) set(h handler) {
+	name := funcName(h.sign)
+	for i := range r.funcs {
+		if funcName(r.funcs[i].sign) == name {
+			r.funcs[i] = h
+			return
+		}
+	}
+	r.funcs = append(r.funcs, h)
+}
+
+// RegisterHeader adds the Sass src as the header name.  Headers are
+// loaded before the input in the order they were registered, without
+// changing the line numbers of the input.  A header with the same name
+// is replaced.
+func (r *Registry) RegisterHeader(name, src string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setHeader(header{name, src})
+}
+
+func (r *Registry) setHeader(h header) {
+	for i := range r.headers {
+		if r.headers[i].name == h.name {
+			r.headers[i] = h
+			return
+		}
+	}
+	r.headers = append(r.headers, h)
+}
+
+// Remove deletes the function called name.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.funcs {
+		if funcName(r.funcs[i].sign) == name {
+			r.funcs = append(r.funcs[:i], r.funcs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Include adds every function and header in o to r, replacing those
+// with the same name.
+func (r *Registry) Include(o *Registry) {
+	if o == nil || o == r {
+		return
+	}
+	hs, hdrs := o.list(), o.headerList()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range hs {
+		r.set(h)
+	}
+	for _, h := range hdrs {
+		r.setHeader(h)
+	}
+}
+
+// Lookup returns the signature and function registered as name.
+func (r *Registry) Lookup(name string) (string, SassCallback, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, h := range r.funcs {
+		if funcName(h.sign) == name {
+			return h.sign, h.callback, true
+		}
+	}
+	return "", nil, false
+}
+
+// Names lists the functions in the order they were registered.
+func (r *Registry) Names() []string {
+	hs := r.list()
+	names := make([]string, len(hs))
+	for i, h := range hs {
+		names[i] = funcName(h.sign)
+	}
+	return names
+}
+
+// list returns a copy of the functions.
+func (r *Registry) list() []handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]handler(nil), r.funcs...)
+}
+
+// Headers lists the headers in the order they are loaded.
+func (r *Registry) Headers() []string {
+	hdrs := r.headerList()
+	names := make([]string, len(hdrs))
+	for i, h := range hdrs {
+		names[i] = h.name
+	}
+	return names
+}
+
+// headerList returns a copy of the headers.
+func (r *Registry) headerList() []header {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]header(nil), r.headers...)
+}
+
+// funcName returns the name of the function in a signature.
+func funcName(sign string) string {
+	if i := strings.Index(sign, "("); i != -1 {
+		sign = sign[:i]
+	}
+	return strings.TrimSpace(sign)
+}
+
+// registry returns the functions available to ctx.
+func (ctx *Context) registry() *Registry {
+	if ctx.Funcs != nil {
+		return ctx.Funcs
+	}
+	return DefaultRegistry
+}
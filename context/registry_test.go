@@ -0,0 +1,114 @@
+package context
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func constFunc(s string) SassCallback {
+	return func(ctx *Context, usv UnionSassValue) UnionSassValue {
+		res, _ := Marshal(s)
+		return res
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	base := NewRegistry()
+	base.Register("foo()", constFunc("base"))
+	base.Register("bar($a)", constFunc("bar"))
+
+	site := NewRegistry()
+	site.Register("foo($size: 1px)", constFunc("site"))
+	site.Register("baz()", constFunc("baz"))
+
+	r := NewRegistry(base, site)
+	if e := []string{"foo", "bar", "baz"}; !reflect.DeepEqual(e, r.Names()) {
+		t.Errorf("got: %v wanted: %v", r.Names(), e)
+	}
+	if sign, _, _ := r.Lookup("foo"); sign != "foo($size: 1px)" {
+		t.Errorf("foo was not overridden: %s", sign)
+	}
+
+	r.Remove("bar")
+	if _, _, ok := r.Lookup("bar"); ok {
+		t.Error("bar was not removed")
+	}
+	// Composed registries are copies
+	if _, _, ok := base.Lookup("bar"); !ok {
+		t.Error("bar was removed from base")
+	}
+}
+
+func TestRegistryContext(t *testing.T) {
+	in := bytes.NewBufferString(`div {
+  content: foo();
+}`)
+	r := NewRegistry()
+	r.Register("foo()", constFunc("registry"))
+
+	var out bytes.Buffer
+	ctx := Context{Funcs: r}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  content: registry; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+
+	// Cookies replace registry functions
+	in = bytes.NewBufferString(`div {
+  content: foo();
+}`)
+	out.Reset()
+	ctx.Cookies = []Cookie{{"foo()", constFunc("cookie"), &ctx}}
+	err = ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = `div {
+  content: cookie; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+}
+
+func TestRegistryHeaders(t *testing.T) {
+	base := NewRegistry()
+	base.RegisterHeader("square", `@mixin square($size) {
+  width: $size;
+  height: $size;
+}`)
+	base.RegisterHeader("colors", "$red: #f00;")
+	site := NewRegistry()
+	site.RegisterHeader("colors", "$red: #e00;")
+
+	r := NewRegistry(base, site)
+	if e := []string{"square", "colors"}; !reflect.DeepEqual(e, r.Headers()) {
+		t.Errorf("got: %v wanted: %v", r.Headers(), e)
+	}
+
+	in := bytes.NewBufferString(`div {
+  @include square(2px);
+  color: $red;
+}`)
+	var out bytes.Buffer
+	ctx := Context{Funcs: r}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := `div {
+  width: 2px;
+  height: 2px;
+  color: #e00; }
+`
+	if e != out.String() {
+		t.Errorf("got:\n%s\nwanted:\n%s", out.String(), e)
+	}
+}
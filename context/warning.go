@@ -0,0 +1,78 @@
+package context
+
+// #include "sass/context.h"
+import "C"
+
+import "fmt"
+
+// Warning is a message from @warn, @debug or a handler.  File and Line
+// are the position of the @warn, @debug or function call, stdin is
+// translated with LookupPosition when it is set.
+type Warning struct {
+	File    string
+	Line    int
+	Message string
+	// Debug is set for messages from @debug
+	Debug bool
+}
+
+func (w Warning) String() string {
+	kind := "WARNING"
+	if w.Debug {
+		kind = "DEBUG"
+	}
+	if w.File != "" {
+		return fmt.Sprintf("%s: %s:%d: %s", kind, w.File, w.Line, w.Message)
+	}
+	return kind + ": " + w.Message
+}
+
+// Warn records w in Warnings and passes it to OnWarning.
+func (ctx *Context) Warn(w Warning) {
+	if w.File == "" {
+		w.File, w.Line = ctx.calleeFile, ctx.calleeLine
+		if w.File == "stdin" && ctx.LookupPosition != nil {
+			w.File, w.Line = ctx.LookupPosition(w.Line)
+		}
+	}
+	ctx.Warnings = append(ctx.Warnings, w)
+	if ctx.OnWarning != nil {
+		ctx.OnWarning(w)
+	}
+}
+
+// setCallee records the position of the call libsass is executing.
+func (ctx *Context) setCallee(comp *C.struct_Sass_Compiler) {
+	ctx.calleeFile, ctx.calleeLine = "", 0
+	if comp == nil || C.sass_compiler_get_callee_stack_size(comp) == 0 {
+		return
+	}
+	ce := C.sass_compiler_get_last_callee(comp)
+	ctx.calleeFile = C.GoString(C.sass_callee_get_path(ce))
+	ctx.calleeLine = int(C.sass_callee_get_line(ce))
+}
+
+// warnFuncs replace the libsass output of @warn and @debug, they are
+// added to every Context.
+var warnFuncs = NewRegistry()
+
+func init() {
+	warnFuncs.Register("@warn", func(ctx *Context, usv UnionSassValue) UnionSassValue {
+		return ctx.sassWarn(usv, false)
+	})
+	warnFuncs.Register("@debug", func(ctx *Context, usv UnionSassValue) UnionSassValue {
+		return ctx.sassWarn(usv, true)
+	})
+}
+
+func (ctx *Context) sassWarn(usv UnionSassValue, debug bool) UnionSassValue {
+	var msg string
+	err := Unmarshal(usv, &msg)
+	if err != nil {
+		var inf interface{}
+		Unmarshal(usv, &inf)
+		msg = fmt.Sprint(inf)
+	}
+	ctx.Warn(Warning{Message: msg, Debug: debug})
+	return C.sass_make_null()
+}
@@ -0,0 +1,70 @@
+package context
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	in := bytes.NewBufferString(`@warn "careful";
+@debug "here";
+div {
+  color: red;
+}`)
+	var out bytes.Buffer
+	ctx := Context{}
+	var n int
+	ctx.OnWarning = func(w Warning) {
+		n++
+	}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := []Warning{
+		{File: "stdin", Line: 1, Message: "careful"},
+		{File: "stdin", Line: 2, Message: "here", Debug: true},
+	}
+	if !reflect.DeepEqual(e, ctx.Warnings) {
+		t.Errorf("got: %v wanted: %v", ctx.Warnings, e)
+	}
+	if n != 2 {
+		t.Errorf("OnWarning was called %d times", n)
+	}
+}
+
+func TestWarningPosition(t *testing.T) {
+	in := bytes.NewBufferString(`@mixin careful {
+  @warn "careful";
+}
+div {
+  @include careful;
+}`)
+	var out bytes.Buffer
+	ctx := Context{
+		LookupPosition: func(line int) (string, int) {
+			return "_mixins.scss", line + 10
+		},
+	}
+	err := ctx.Compile(in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := []Warning{{File: "_mixins.scss", Line: 12, Message: "careful"}}
+	if !reflect.DeepEqual(e, ctx.Warnings) {
+		t.Errorf("got: %v wanted: %v", ctx.Warnings, e)
+	}
+}
+
+func TestWarningString(t *testing.T) {
+	w := Warning{File: "a.scss", Line: 3, Message: "careful"}
+	if e := "WARNING: a.scss:3: careful"; e != w.String() {
+		t.Errorf("got: %s wanted: %s", w, e)
+	}
+	w = Warning{Message: "here", Debug: true}
+	if e := "DEBUG: here"; e != w.String() {
+		t.Errorf("got: %s wanted: %s", w, e)
+	}
+}
@@ -9,36 +9,72 @@ import (
 	"strings"
 )
 
+// ImportName is an @import of Name from a file in Dir.  The same name
+// imported from two directories can resolve to different files.
+type ImportName struct {
+	Dir, Name string
+}
+
+// record saves the path that the @import of name from dir resolved to.
+func (p *Parser) record(dir, name, path string) {
+	if p.Paths == nil {
+		p.Paths = make(map[ImportName]string)
+	}
+	p.Paths[ImportName{dir, name}] = path
+	for _, imp := range p.Imports {
+		if imp == path {
+			return
+		}
+	}
+	p.Imports = append(p.Imports, path)
+}
+
+// importExts are the extensions tried in order when resolving an
+// @import, SCSS is preferred over the indented syntax.
+var importExts = []string{".scss", ".sass"}
+
+// indented reports whether the file at path is written in the indented
+// Sass syntax.
+func indented(path string) bool {
+	return filepath.Ext(path) == ".sass"
+}
+
 func (p *Parser) ImportPath(dir, file string) (string, string, error) {
 	// fmt.Println("Importing: " + file)
 	baseerr := ""
+	var (
+		pwd      string
+		contents []byte
+		err      error
+	)
 	//Load and retrieve all tokens from imported file
-	path, _ := filepath.Abs(fmt.Sprintf("%s/%s.scss", dir, file))
-	pwd := filepath.Dir(path)
-	// Sass put _ in front of imported files
-	fpath := filepath.Join(pwd, "/_"+filepath.Base(path))
-	contents, err := ioutil.ReadFile(fpath)
-	if err == nil {
-		return pwd, string(contents), nil
+	for _, ext := range importExts {
+		path, _ := filepath.Abs(fmt.Sprintf("%s/%s%s", dir, file, ext))
+		pwd = filepath.Dir(path)
+		// Sass put _ in front of imported files
+		fpath := filepath.Join(pwd, "/_"+filepath.Base(path))
+		contents, err = ioutil.ReadFile(fpath)
+		if err == nil {
+			p.record(dir, file, fpath)
+			return pwd, string(contents), nil
+		}
+		baseerr += fpath + "\n"
 	}
-	baseerr += fpath + "\n"
 	if strings.HasSuffix(err.Error(), "no such file or directory") {
 		// Look through the import path for the file
 		for _, lib := range p.Includes {
 			path, _ := filepath.Abs(lib + "/" + file)
 			pwd := filepath.Dir(path)
-			fpath = filepath.Join(pwd, "/_"+filepath.Base(path)+".scss")
-			contents, err := ioutil.ReadFile(fpath)
-			baseerr += fpath + "\n"
-			if err == nil {
-				return pwd, string(contents), nil
-			} else {
-				// Attempt invalid name lookup (no _)
-				fpath = filepath.Join(pwd, "/"+filepath.Base(path)+".scss")
-				contents, err = ioutil.ReadFile(fpath)
-				baseerr += fpath + "\n"
-				if err == nil {
-					return pwd, string(contents), nil
+			for _, ext := range importExts {
+				// Attempt invalid name lookup (no _) after the partial
+				for _, prefix := range []string{"/_", "/"} {
+					fpath := filepath.Join(pwd, prefix+filepath.Base(path)+ext)
+					contents, err := ioutil.ReadFile(fpath)
+					baseerr += fpath + "\n"
+					if err == nil {
+						p.record(dir, file, fpath)
+						return pwd, string(contents), nil
+					}
 				}
 			}
 		}
@@ -54,3 +90,22 @@ func (p *Parser) ImportPath(dir, file string) (string, string, error) {
 	return pwd, string(contents), errors.New("Could not import: " +
 		file + "\nTried:\n" + baseerr)
 }
+
+// Import resolves the @import of url from the file prev for libsass,
+// using the same rules as ImportPath.  prev is "stdin" for the input
+// passed to Start.
+func (p *Parser) Import(url, prev string) (string, []byte, error) {
+	dir := p.SassDir
+	if prev != "" && prev != "stdin" {
+		dir = filepath.Dir(prev)
+	}
+	_, contents, err := p.ImportPath(dir, url)
+	if err != nil {
+		return "", nil, err
+	}
+	path, ok := p.Paths[ImportName{dir, url}]
+	if !ok {
+		path = url
+	}
+	return path, []byte(contents), nil
+}
@@ -3,6 +3,7 @@ package sprite_sass
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -52,9 +53,188 @@ func TestMissingImport(t *testing.T) {
 		t.Errorf("Result from import on missing file: %s", file)
 	}
 
-	rel := strings.Replace(err.Error(), os.Getenv("PWD"), "", 1)
+	rel := strings.Replace(err.Error(), os.Getenv("PWD"), "", -1)
 	if e := "Could not import: notafile\nTried:\n" +
-		"/test/_notafile.scss\n"; rel != e {
+		"/test/_notafile.scss\n" +
+		"/test/_notafile.sass\n"; rel != e {
 		t.Errorf("Error message invalid expected:%s\nwas:%s", e, err.Error())
 	}
 }
+
+func TestImportRecordsPaths(t *testing.T) {
+	p := Parser{
+		Includes: []string{"test/sass"},
+	}
+	_, err := p.Start(fileReader("test/sass/import.scss"), "test/sass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Imports) == 0 {
+		t.Fatal("No imports were recorded")
+	}
+	rel := strings.Replace(p.Imports[0], os.Getenv("PWD"), "", 1)
+	if e := "/test/sass/_var.scss"; e != rel {
+		t.Errorf("Invalid import expected:%s\nwas:%s", e, rel)
+	}
+}
+
+func TestImportKeepImports(t *testing.T) {
+	p := Parser{
+		Includes:    []string{"test/sass"},
+		MainFile:    "test/sass/import.scss",
+		KeepImports: true,
+	}
+	bs, err := p.Start(fileReader("test/sass/import.scss"), "test/sass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `@import "var";`) {
+		t.Errorf("@import was not kept:\n%s", string(bs))
+	}
+	if len(p.Imports) == 0 {
+		t.Error("No imports were recorded")
+	}
+
+	path, contents, err := p.Import("var", "test/sass/import.scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := strings.Replace(path, os.Getenv("PWD"), "", 1)
+	if e := "/test/sass/_var.scss"; e != rel {
+		t.Errorf("Invalid path expected:%s\nwas:%s", e, rel)
+	}
+	if e := fileString("test/sass/_var.scss"); e != string(contents) {
+		t.Errorf("Contents did not match expected:%s\nwas:%s", e, contents)
+	}
+
+	_, err = p.Start(strings.NewReader(`@import url("foo.css");`), "test/sass")
+	if err != nil {
+		t.Errorf("CSS import was not left to libsass: %s", err)
+	}
+}
+
+func TestImportIndented(t *testing.T) {
+	p := Parser{
+		Includes: []string{"test/sass"},
+	}
+	_, res, err := p.ImportPath("test", "indent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := fileString("test/sass/_indent.sass"); e != res {
+		t.Errorf("Contents did not match expected:%s\nwas:%s", e, res)
+	}
+	if path := p.Paths[ImportName{"test", "indent"}]; !indented(path) {
+		t.Errorf("%s is not indented", path)
+	}
+
+	// Indented partials are not inlined into SCSS
+	in := `@import "indent";
+div {
+  @include indent-box;
+}`
+	bs, err := p.Start(strings.NewReader(in), "test/sass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in != string(bs) {
+		t.Errorf("got:\n%s\nwanted:\n%s", string(bs), in)
+	}
+}
+
+// toSCSS ends the @import lines of indented Sass with a semicolon,
+// which is all the parser needs to read them.
+func toSCSS(src []byte) []byte {
+	lines := strings.Split(string(src), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@import") {
+			lines[i] = line + ";"
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func TestImportIndentedImports(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		p := Parser{
+			Includes:    []string{"test/sass"},
+			KeepImports: keep,
+			ToSCSS:      toSCSS,
+		}
+		_, err := p.Start(strings.NewReader(`@import "indentimport";`), "test/sass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rel []string
+		for _, path := range p.Imports {
+			rel = append(rel, strings.Replace(path, os.Getenv("PWD"), "", 1))
+		}
+		// Partials imported by an indented partial are recorded
+		e := []string{
+			"/test/sass/_indentimport.sass",
+			"/test/sass/_var.scss",
+			"/sass/_sprite.scss",
+		}
+		if strings.Join(e, " ") != strings.Join(rel, " ") {
+			t.Errorf("KeepImports %t got: %v wanted: %v", keep, rel, e)
+		}
+	}
+}
+
+func TestImportIndentedEntry(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		p := Parser{
+			MainFile:    "test/sass/main.sass",
+			KeepImports: keep,
+			ToSCSS:      toSCSS,
+		}
+		in := "@import \"var\"\n@import \"indent\"\n"
+		_, err := p.Start(strings.NewReader(in), "test/sass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rel []string
+		for _, path := range p.Imports {
+			rel = append(rel, strings.Replace(path, os.Getenv("PWD"), "", 1))
+		}
+		// Every import of an indented entry is recorded
+		e := []string{
+			"/test/sass/_var.scss",
+			"/sass/_sprite.scss",
+			"/test/sass/_indent.sass",
+		}
+		if strings.Join(e, " ") != strings.Join(rel, " ") {
+			t.Errorf("KeepImports %t got: %v wanted: %v", keep, rel, e)
+		}
+	}
+}
+
+func TestImportRecordsSameName(t *testing.T) {
+	p := Parser{}
+	in := `@import "dup/one/x";
+@import "dup/two/x";
+@import "dup/one/x";`
+	_, err := p.Start(strings.NewReader(in), "test/sass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rel []string
+	for _, path := range p.Imports {
+		rel = append(rel, strings.Replace(path, os.Getenv("PWD"), "", 1))
+	}
+	e := []string{
+		"/test/sass/dup/one/_x.scss",
+		"/test/sass/dup/one/_vars.scss",
+		"/test/sass/dup/two/_x.scss",
+		"/test/sass/dup/two/_vars.scss",
+	}
+	if strings.Join(e, " ") != strings.Join(rel, " ") {
+		t.Errorf("got: %v wanted: %v", rel, e)
+	}
+
+	one := p.Paths[ImportName{filepath.Join(os.Getenv("PWD"), "test/sass/dup/one"), "vars"}]
+	if e := "/test/sass/dup/one/_vars.scss"; !strings.HasSuffix(one, e) {
+		t.Errorf("got: %s wanted: %s", one, e)
+	}
+}
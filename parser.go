@@ -7,6 +7,8 @@ import (
 	"log"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	. "github.com/wellington/wellington/lexer"
 	. "github.com/wellington/wellington/token"
@@ -33,13 +35,6 @@ $sprites: map_merge($sprites,(140: (
   )));
 */
 
-var weAreNeverGettingBackTogether = []byte(`@mixin sprite-dimensions($map, $name) {
-  $file: sprite-file($map, $name);
-  height: image-height($file);
-  width: image-width($file);
-}
-`)
-
 func init() {
 	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime)
 }
@@ -62,10 +57,27 @@ type Parser struct {
 	ProjDir string
 	ImageDir string
 	Includes []string
+	// Imports lists the absolute paths of every file read while
+	// resolving @import statements, each path is listed once.
+	Imports []string
+	// Paths maps each @import to the file it resolved to
+	Paths    map[ImportName]string
 	Items    []Item
 	Output   []byte
 	Line     map[int]string
 	LineKeys []int
+	// files are the lines of the output where each file, or the rest
+	// of a file after an @import, starts
+	files map[int]fileLine
+
+	// KeepImports leaves @import statements in the output of Start for
+	// libsass to resolve with Import.  Imports are still read to find
+	// the files the input depends on.
+	KeepImports bool
+	// ToSCSS converts indented Sass to SCSS, it is used to read the
+	// imports of indented partials.  When nil those imports are not
+	// recorded.
+	ToSCSS func([]byte) []byte
 }
 
 // NewParser returns a pointer to a Parser object.
@@ -80,6 +92,7 @@ func NewParser() *Parser {
 // (created via sprite-map calls).
 func (p *Parser) Start(in io.Reader, pkgdir string) ([]byte, error) {
 	p.Line = make(map[int]string)
+	p.files = make(map[int]fileLine)
 
 	// Setup paths
 	if p.MainFile == "" {
@@ -93,10 +106,15 @@ func (p *Parser) Start(in io.Reader, pkgdir string) ([]byte, error) {
 	}
 	buf := bytes.NewBuffer(make([]byte, 0, bytes.MinRead))
 	buf.ReadFrom(in)
+	src := buf.Bytes()
+	if indented(p.MainFile) && p.ToSCSS != nil {
+		// The lexer only reads SCSS
+		src = p.ToSCSS(src)
+	}
 
 	// This pass resolves all the imports, but positions will
 	// be off due to @import calls
-	items, input, err := p.GetItems(pkgdir, p.MainFile, string(buf.Bytes()))
+	items, input, err := p.GetItems(pkgdir, p.MainFile, string(src))
 	if err != nil {
 		return []byte(""), err
 	}
@@ -122,6 +140,9 @@ func (p *Parser) Start(in io.Reader, pkgdir string) ([]byte, error) {
 	// Parsing is no longer necessary
 	// p.Parse(p.Items)
 	p.Output = []byte(p.Input)
+	if p.KeepImports {
+		p.Output = buf.Bytes()
+	}
 	// Perform substitutions
 	// p.Replace()
 	// rel := []byte(fmt.Sprintf(`$rel: "%s";%s`,
@@ -129,7 +150,41 @@ func (p *Parser) Start(in io.Reader, pkgdir string) ([]byte, error) {
 
 	// Code that we will never support, ever
 
-	return append(weAreNeverGettingBackTogether, p.Output...), nil
+	return p.Output, nil
+}
+
+// Ref is a file referenced by a function call in the input,
+// ie. sprite-map("*.png") or font-url("arial.eot").
+type Ref struct {
+	Func, Path string
+}
+
+// refFuncs are the functions whose first argument is a file
+var refFuncs = map[string]bool{
+	"sprite-map":   true,
+	"image-url":    true,
+	"inline-image": true,
+	"image-height": true,
+	"image-width":  true,
+	"font-url":     true,
+}
+
+// Refs lists the files referenced by function calls in the input and
+// its imports.  Paths are returned as written, relative to the image
+// or font directory.  Only literal arguments are found, paths stored
+// in variables are ignored.
+func (p *Parser) Refs() []Ref {
+	var refs []Ref
+	for i := 0; i+2 < len(p.Items); i++ {
+		fn := p.Items[i]
+		if !refFuncs[fn.Value] ||
+			p.Items[i+1].Type != LPAREN ||
+			p.Items[i+2].Type != FILE {
+			continue
+		}
+		refs = append(refs, Ref{fn.Value, p.Items[i+2].Value})
+	}
+	return refs
 }
 
 // Rel builds relative image paths, not compatible with sprites.
@@ -143,12 +198,6 @@ func (p *Parser) Rel() string {
 func (p *Parser) LookupFile(position int) string {
 	// Shift to 0 index
 	pos := position - 1
-	// Adjust for shift from preamble
-	shift := bytes.Count(weAreNeverGettingBackTogether, []byte{'\n'})
-	pos = pos - shift
-	if pos < 0 {
-		return "mixin"
-	}
 	for i, n := range p.LineKeys {
 		if n > pos {
 			if i == 0 {
@@ -168,6 +217,52 @@ func (p *Parser) LookupFile(position int) string {
 	return fmt.Sprintf("%s:%d", p.MainFile, pos-p.LineKeys[len(p.LineKeys)-1]+1)
 }
 
+// LookupPosition translates a line position into the path of the file
+// it belongs to and the line number in that file.
+func (p *Parser) LookupPosition(position int) (string, int) {
+	if p.KeepImports {
+		// Imports are not inlined, only the input is seen
+		if p.MainFile == "string" {
+			return "stdin", position
+		}
+		return p.MainFile, position
+	}
+	pos, at := position-1, -1
+	for n := range p.files {
+		if n <= pos && n > at {
+			at = n
+		}
+	}
+	if f, ok := p.files[at]; ok {
+		return f.path, f.line + pos - at
+	}
+	loc := p.LookupFile(position)
+	i := strings.LastIndex(loc, ":")
+	if i == -1 {
+		return loc, 0
+	}
+	name := loc[:i]
+	line, _ := strconv.Atoi(loc[i+1:])
+	if name == "string" {
+		name = p.MainFile
+	}
+	return name, line
+}
+
+// fileLine is the line of the file at path shown at a line of the output
+type fileLine struct {
+	path string
+	line int
+}
+
+// locate records that the output line at shows line of the file path.
+func (p *Parser) locate(at int, path string, line int) {
+	if p.files == nil {
+		p.files = make(map[int]fileLine)
+	}
+	p.files[at] = fileLine{path, line}
+}
+
 // Find Paren that matches the current (
 // func RParen(items []Item) (int, int) {
 // 	if len(items) == 0 {
@@ -289,6 +384,13 @@ func (p *Parser) LookupFile(position int) string {
 // adding the tokens to the Parser object.
 // TODO: Convert this to byte slice in/out
 func (p *Parser) GetItems(pwd, filename, input string) ([]Item, string, error) {
+	return p.getItems(pwd, filename, filename, input, 0)
+}
+
+// getItems is GetItems for the file filename read from path, its
+// output starts at line base of the output of Start.
+func (p *Parser) getItems(pwd, filename, path, input string, base int) ([]Item, string, error) {
+	p.locate(base, path, 1)
 
 	var (
 		status    []Item
@@ -339,10 +441,34 @@ func (p *Parser) GetItems(pwd, filename, input string) ([]Item, string, error) {
 					}
 				}
 				p.Line[lineCount] = filename
-				pwd, contents, err := p.ImportPath(pwd, filename)
+				ipwd, contents, err := p.ImportPath(pwd, filename)
+				ipath := p.Paths[ImportName{pwd, filename}]
+				if err != nil && p.KeepImports {
+					// libsass reports imports that can not be
+					// found, CSS imports are left alone.
+					filename = lastname
+					importing = false
+					continue
+				}
 				if err != nil {
 					return nil, "", err
 				}
+				if indented(ipath) {
+					// The lexer only reads SCSS, indented
+					// partials are left for libsass.  Their
+					// imports are still recorded.
+					if p.ToSCSS != nil {
+						if err := p.importsOf(ipwd, filename, ipath,
+							p.ToSCSS([]byte(contents))); err != nil {
+							return nil, "", err
+						}
+					}
+					p.Line[lineCount] = lastname
+					filename = lastname
+					importing = false
+					pos = last.Pos
+					continue
+				}
 				//Eat the semicolon
 				item := lex.Next()
 				if item.Type != SEMIC {
@@ -352,10 +478,12 @@ func (p *Parser) GetItems(pwd, filename, input string) ([]Item, string, error) {
 				// FIXME: Hack to delete newline, hopefully this doesn't break stuff
 				// then readd it to the linecount
 				pos = item.Pos + len(item.Value)
-				moreTokens, moreOutput, err := p.GetItems(
-					pwd,
+				moreTokens, moreOutput, err := p.getItems(
+					ipwd,
 					filename,
-					contents)
+					ipath,
+					contents,
+					base+bytes.Count(output, []byte("\n")))
 				// If importing was successful, each token must be moved
 				// forward by the position of the @import call that made
 				// it available.
@@ -374,6 +502,9 @@ func (p *Parser) GetItems(pwd, filename, input string) ([]Item, string, error) {
 				filename = lastname
 
 				output = append(output, moreOutput...)
+				// The rest of the @import line continues this file
+				p.locate(base+bytes.Count(output, []byte("\n")), path,
+					1+strings.Count(input[:last.Pos], "\n"))
 				status = append(status, moreTokens...)
 				importing = false
 			} else {
@@ -385,3 +516,13 @@ func (p *Parser) GetItems(pwd, filename, input string) ([]Item, string, error) {
 	}
 
 }
+
+// importsOf reads the imports of the partial filename in pwd without
+// adding it to the output.
+func (p *Parser) importsOf(pwd, filename, path string, input []byte) error {
+	line, files := p.Line, p.files
+	p.Line, p.files = make(map[int]string), make(map[int]fileLine)
+	_, _, err := p.getItems(pwd, filename, path, string(input), 0)
+	p.Line, p.files = line, files
+	return err
+}
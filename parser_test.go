@@ -211,15 +211,12 @@ p {
 		t.Error(err)
 	}
 	tmap := [...]string{
-		3:  "mixin", // Injected mixin, perhaps we need a better name than top level file
-		4:  "mixin",
-		5:  "mixin",
-		6:  "string:1",
-		7:  "string:2",
-		8:  "string:3",
-		9:  "string:4",
-		10: "string:5",
-		11: "string:6",
+		1: "string:1",
+		2: "string:2",
+		3: "string:3",
+		4: "string:4",
+		5: "string:5",
+		6: "string:6",
 	}
 
 	for i := range tmap {
@@ -234,7 +231,7 @@ p {
 		fmt.Printf("% #v\n", p.Line)
 		lineArr := bytes.Split(bs, []byte("\n"))
 		for i := range lineArr {
-			fmt.Printf("%2d: %2d: %s\n", i+1-5, i+1, string(lineArr[i]))
+			fmt.Printf("%2d: %s\n", i+1, string(lineArr[i]))
 		}
 	}
 
@@ -255,12 +252,9 @@ p {
 		t.Error(err)
 	}
 	tmap := [...]string{
-		3: "mixin", // Injected mixin, perhaps we need a better name than top level file
-		4: "mixin",
-		5: "mixin",
-		6: "file:1",
-		7: "file:2",
-		8: "file:3",
+		1: "file:1",
+		2: "file:2",
+		3: "file:3",
 	}
 
 	for i := range tmap {
@@ -273,10 +267,10 @@ p {
 	}
 
 	smap := [...]string{
-		9:  "string:2",
-		10: "string:3",
-		11: "string:4",
-		12: "string:5",
+		4: "string:2",
+		5: "string:3",
+		6: "string:4",
+		7: "string:5",
 	}
 
 	for i := range smap {
@@ -291,7 +285,131 @@ p {
 		fmt.Printf("% #v\n", p.Line)
 		lineArr := bytes.Split(bs, []byte("\n"))
 		for i := range lineArr {
-			fmt.Printf("%2d: %2d: %s\n", i+1-5, i+1, string(lineArr[i]))
+			fmt.Printf("%2d: %s\n", i+1, string(lineArr[i]))
+		}
+	}
+}
+
+func TestParseLookupPosition(t *testing.T) {
+	p := Parser{
+		BuildDir: "test/build",
+		Includes: []string{"test/sass"},
+	}
+	in := bytes.NewBufferString(`@import "file";
+p {
+  line-height: 2em;
+}`)
+	_, err := p.Start(in, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, line := p.LookupPosition(2)
+	rel := strings.Replace(file, os.Getenv("PWD"), "", 1)
+	if e := "/test/sass/file.scss"; e != rel {
+		t.Errorf("got: %s wanted: %s", rel, e)
+	}
+	if e := 2; e != line {
+		t.Errorf("got: %d wanted: %d", line, e)
+	}
+}
+
+func TestParseLookupPositionSameName(t *testing.T) {
+	p := Parser{}
+	in := bytes.NewBufferString(`@import "dup/one/x";
+@import "dup/two/x";
+p {
+  width: $two;
+}`)
+	bs, err := p.Start(in, "test/sass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both directories import "vars", each must find its own
+	lines := map[string]struct {
+		file string
+		line int
+	}{
+		"$one":          {"/test/sass/dup/one/_vars.scss", 1},
+		"$two":          {"/test/sass/dup/two/_vars.scss", 1},
+		"  width: $two": {"string", 4},
+	}
+	for i, l := range strings.Split(string(bs), "\n") {
+		for prefix, e := range lines {
+			if !strings.HasPrefix(l, prefix) {
+				continue
+			}
+			file, line := p.LookupPosition(i + 1)
+			rel := strings.Replace(file, os.Getenv("PWD"), "", 1)
+			if rel != e.file || line != e.line {
+				t.Errorf("%s got: %s:%d wanted: %s:%d",
+					prefix, rel, line, e.file, e.line)
+			}
+			delete(lines, prefix)
+		}
+	}
+	if len(lines) > 0 {
+		t.Errorf("lines not found in output: %v", lines)
+	}
+}
+
+func TestParseLookupPositionKeepImports(t *testing.T) {
+	p := Parser{
+		Includes:    []string{"test/sass"},
+		MainFile:    "main.scss",
+		KeepImports: true,
+	}
+	in := bytes.NewBufferString(`@import "file";
+p {
+  line-height: 2em;
+}`)
+	_, err := p.Start(in, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Imports are not inlined, so the position is in the main file
+	if file, line := p.LookupPosition(2); file != "main.scss" || line != 2 {
+		t.Errorf("got: %s:%d wanted: main.scss:2", file, line)
+	}
+
+	// Input without a file is read from stdin
+	p = Parser{KeepImports: true}
+	if _, err := p.Start(bytes.NewBufferString("p {}"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := p.LookupPosition(1); file != "stdin" {
+		t.Errorf("got: %s wanted: stdin", file)
+	}
+}
+
+func TestParseRefs(t *testing.T) {
+	p := Parser{}
+	in := bytes.NewBufferString(`$sprites: sprite-map("img/*.png");
+div {
+  height: image-height(sprite-file($sprites, 139));
+  background: image-url('img/139.png');
+  src: font-url("arial.eot", true);
+  width: image-width($path);
+}`)
+	_, err := p.Start(in, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := []Ref{
+		{"sprite-map", "img/*.png"},
+		{"image-url", "img/139.png"},
+		{"font-url", "arial.eot"},
+	}
+	refs := p.Refs()
+	if len(refs) != len(e) {
+		t.Fatalf("got: %v wanted: %v", refs, e)
+	}
+	for i := range e {
+		if e[i] != refs[i] {
+			t.Errorf("got: %v wanted: %v", refs[i], e[i])
 		}
 	}
 }
@@ -1,7 +1,7 @@
 #!/bin/bash
 
 HASH=$(cat .libsass_version)
-export LIBSASS_VERSION=HASH
+export LIBSASS_VERSION=$HASH
 [ -d libsass ] || mkdir libsass
 if [ -f libsass/"libsass.$HASH.tar.gz" ];
 then
@@ -10,7 +10,7 @@ else
 	echo "Fetching source of $HASH"
 	cd libsass
 	make clean
-	curl -L "https://github.com/drewwells/libsass/archive/$HASH.tar.gz" -o "libsass.$HASH.tar.gz"
+	curl -L "https://github.com/sass/libsass/archive/$HASH.tar.gz" -o "libsass.$HASH.tar.gz"
 	tar xvf "libsass.$HASH.tar.gz" --strip 1
 	cd ..
 fi
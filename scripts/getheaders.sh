@@ -3,9 +3,10 @@
 DIR=${1:-libsass}
 
 # Fetch headers from libsass project, assumes ./libsass
-FILES="sass.h sass_context.h sass_functions.h sass_interface.h sass_values.h"
+FILES="sass.h sass2scss.h sass/base.h sass/context.h sass/functions.h sass/values.h sass/version.h"
 
+mkdir -p context/sass
 for F in $FILES
 do
-	cp $DIR/$F context/$F
+	cp $DIR/include/$F context/$F
 done
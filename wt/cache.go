@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sprite "github.com/wellington/wellington"
+	"github.com/wellington/wellington/context"
+)
+
+// CacheDir is the default location of the build cache.
+const CacheDir = ".wellington-cache"
+
+// BuildCache remembers the inputs of every compiled entry, so entries
+// are only compiled again when a partial, image, font or option used
+// to build them has changed.
+type BuildCache struct {
+	Dir     string
+	options string
+}
+
+// cacheRecord is the state saved for an entry after it compiles.
+// CSS is the file written for Output, they differ when the name is
+// fingerprinted, and Map is its source map file.  Inputs maps every
+// file that was read to the hash of its contents.
+type cacheRecord struct {
+	Entry    string            `json:"entry"`
+	Output   string            `json:"output"`
+	CSS      string            `json:"css"`
+	Map      string            `json:"map,omitempty"`
+	Options  string            `json:"options"`
+	Partials []string          `json:"partials"`
+	Sprites  []string          `json:"sprites,omitempty"`
+	Inputs   map[string]string `json:"inputs"`
+	// Globs maps the patterns of sprite-map to the files they matched
+	Globs map[string][]string `json:"globs,omitempty"`
+}
+
+// NewBuildCache returns a cache stored in dir for the current command
+// line options.
+func NewBuildCache(dir string) (*BuildCache, error) {
+	err := os.MkdirAll(filepath.Join(dir, "entries"), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildCache{Dir: dir, options: optionsHash()}, nil
+}
+
+// optionsHash identifies the settings that change the CSS produced for
+// an entry.
+func optionsHash() string {
+	h := sha1.New()
+	fmt.Fprintln(h, version, Style, Precision, Comments)
+	fmt.Fprintln(h, Dir, Font, Gen, BuildDir, SrcRoot, Includes)
+	fmt.Fprintln(h, SourceMap, SourceMapInline, SourceMapContents, Fingerprint)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *BuildCache) path(entry string) string {
+	abs, _ := filepath.Abs(entry)
+	sum := sha1.Sum([]byte(abs))
+	return filepath.Join(c.Dir, "entries", hex.EncodeToString(sum[:])+".json")
+}
+
+// Fresh reports whether the CSS in output is up to date with entry.
+// The returned record holds the imports and sprites of the last compile.
+func (c *BuildCache) Fresh(entry, output string) (*cacheRecord, bool) {
+	if output == "" {
+		return nil, false
+	}
+	bs, err := ioutil.ReadFile(c.path(entry))
+	if err != nil {
+		return nil, false
+	}
+	var rec cacheRecord
+	if json.Unmarshal(bs, &rec) != nil {
+		return nil, false
+	}
+	if rec.Options != c.options || rec.Output != output {
+		return nil, false
+	}
+	for _, out := range []string{rec.CSS, rec.Map} {
+		if out == "" {
+			continue
+		}
+		if _, err := os.Stat(out); err != nil {
+			return nil, false
+		}
+	}
+	for _, f := range rec.Sprites {
+		if _, err := os.Stat(f); err != nil {
+			return nil, false
+		}
+	}
+	for f, sum := range rec.Inputs {
+		if hashFile(f) != sum {
+			return nil, false
+		}
+	}
+	for pattern, files := range rec.Globs {
+		matches, _ := filepath.Glob(pattern)
+		if strings.Join(matches, "\n") != strings.Join(files, "\n") {
+			return nil, false
+		}
+	}
+	return &rec, true
+}
+
+// Save records the files read by ctx to compile entry and the sprites
+// it created.  The CSS for output was written to css and its source map
+// to sourceMap.
+func (c *BuildCache) Save(entry, output, css, sourceMap string, par *sprite.Parser, ctx *context.Context, sprites []string) error {
+	rec := cacheRecord{
+		Entry:    entry,
+		Output:   output,
+		CSS:      css,
+		Map:      sourceMap,
+		Options:  c.options,
+		Partials: unique(par.Imports),
+		Sprites:  sprites,
+		Inputs:   make(map[string]string),
+		Globs:    spriteGlobs(ctx),
+	}
+	for _, f := range append(append([]string{entry}, rec.Partials...),
+		ctx.IncludedFiles()...) {
+		rec.Inputs[f] = hashFile(f)
+	}
+	bs, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path(entry), bs, 0644)
+}
+
+// spriteGlobs lists the files matched by the patterns of the sprites
+// used by ctx, so images added to a pattern are noticed.
+func spriteGlobs(ctx *context.Context) map[string][]string {
+	globs := make(map[string][]string)
+	ctx.Sprites.RLock()
+	defer ctx.Sprites.RUnlock()
+	for _, key := range ctx.IncludedSprites() {
+		imgs := ctx.Sprites.M[key]
+		for _, glob := range imgs.Globs {
+			pattern := filepath.Join(imgs.ImageDir, glob)
+			globs[pattern], _ = filepath.Glob(pattern)
+		}
+	}
+	return globs
+}
+
+// hashFile returns the hash of the contents of path.  Files that can
+// not be read hash to the empty string.
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
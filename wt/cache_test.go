@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/wellington/spritewell"
+	sprite "github.com/wellington/wellington"
+	"github.com/wellington/wellington/context"
+)
+
+// saveEntry writes an entry, a partial, an image and a sprite glob to
+// dir and saves them in a new cache.
+func saveEntry(t *testing.T, dir string) *BuildCache {
+	os.MkdirAll(filepath.Join(dir, "icons"), 0755)
+	os.MkdirAll(filepath.Join(dir, "build"), 0755)
+	for _, f := range []string{"a.scss", "_b.scss", "x.png", "icons/1.png",
+		"build/a.css", "build/a.css.map", "build/icons.png"} {
+		err := ioutil.WriteFile(filepath.Join(dir, f), []byte(f), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache, err := NewBuildCache(filepath.Join(dir, CacheDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.NewContext()
+	ctx.IncludeFile(filepath.Join(dir, "x.png"))
+	ctx.Sprites.M["icons"] = spritewell.ImageList{
+		ImageDir: dir,
+		Globs:    []string{"icons/*.png"},
+	}
+	ctx.IncludeSprite("icons")
+	par := &sprite.Parser{Imports: []string{filepath.Join(dir, "_b.scss")}}
+	out := filepath.Join(dir, "build/a.css")
+	err = cache.Save(filepath.Join(dir, "a.scss"), out, out, out+".map",
+		par, ctx, []string{filepath.Join(dir, "build/icons.png")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestBuildCacheFresh(t *testing.T) {
+	defer func() { Style = "nested" }()
+	tests := []struct {
+		name   string
+		change func(dir string) *BuildCache
+		output string
+	}{
+		{"unchanged", nil, ""},
+		{"stdout", nil, "-"},
+		{"other output", nil, "build/b.css"},
+		{"partial", func(dir string) *BuildCache {
+			ioutil.WriteFile(filepath.Join(dir, "_b.scss"), []byte("changed"), 0644)
+			return nil
+		}, ""},
+		{"entry", func(dir string) *BuildCache {
+			ioutil.WriteFile(filepath.Join(dir, "a.scss"), []byte("changed"), 0644)
+			return nil
+		}, ""},
+		{"image", func(dir string) *BuildCache {
+			ioutil.WriteFile(filepath.Join(dir, "x.png"), []byte("changed"), 0644)
+			return nil
+		}, ""},
+		{"sprite glob", func(dir string) *BuildCache {
+			ioutil.WriteFile(filepath.Join(dir, "icons/2.png"), nil, 0644)
+			return nil
+		}, ""},
+		{"css removed", func(dir string) *BuildCache {
+			os.Remove(filepath.Join(dir, "build/a.css"))
+			return nil
+		}, ""},
+		{"map removed", func(dir string) *BuildCache {
+			os.Remove(filepath.Join(dir, "build/a.css.map"))
+			return nil
+		}, ""},
+		{"sprite removed", func(dir string) *BuildCache {
+			os.Remove(filepath.Join(dir, "build/icons.png"))
+			return nil
+		}, ""},
+		{"options", func(dir string) *BuildCache {
+			Style = "compressed"
+			cache, _ := NewBuildCache(filepath.Join(dir, CacheDir))
+			return cache
+		}, ""},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		Style = "nested"
+		cache := saveEntry(t, dir)
+		if test.change != nil {
+			if c := test.change(dir); c != nil {
+				cache = c
+			}
+		}
+		out := filepath.Join(dir, "build/a.css")
+		switch test.output {
+		case "-":
+			out = ""
+		case "":
+		default:
+			out = filepath.Join(dir, test.output)
+		}
+
+		rec, fresh := cache.Fresh(filepath.Join(dir, "a.scss"), out)
+		if e := test.name == "unchanged"; fresh != e {
+			t.Errorf("%s: got fresh %t wanted %t", test.name, fresh, e)
+		}
+		if fresh {
+			e := []string{filepath.Join(dir, "_b.scss")}
+			if !reflect.DeepEqual(rec.Partials, e) {
+				t.Errorf("%s: got partials %v wanted %v", test.name, rec.Partials, e)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFile is the project file read from the working directory when
+// -config is not specified.
+const ConfigFile = "wellington.json"
+
+// Config holds the project settings read from a wellington.json file.
+// Relative paths are resolved from the directory of the file.
+//
+//	{
+//	  "image_dir": "img",
+//	  "build_dir": "build/css",
+//	  "src_root": "sass",
+//	  "includes": ["sass"],
+//	  "entries": [
+//	    {"glob": "sass/pages/*.scss", "output": "build/css/pages"}
+//	  ]
+//	}
+type Config struct {
+	ImageDir  string   `json:"image_dir"`
+	FontDir   string   `json:"font_dir"`
+	GenDir    string   `json:"gen_dir"`
+	BuildDir  string   `json:"build_dir"`
+	SrcRoot   string   `json:"src_root"`
+	Includes  []string `json:"includes"`
+	Style     string   `json:"style"`
+	Precision int      `json:"precision"`
+	Comments  *bool    `json:"comments"`
+	Entries   []Entry  `json:"entries"`
+
+	dir string
+}
+
+// Entry is a glob of input files.  The CSS for each file is written to
+// Output, or the build directory when Output is empty.
+type Entry struct {
+	Glob   string `json:"glob"`
+	Output string `json:"output"`
+}
+
+// loadConfig reads the project file at path.  When path is empty,
+// wellington.json is read from the working directory if it exists.
+func loadConfig(path string) (*Config, error) {
+	if path == "" {
+		if _, err := os.Stat(ConfigFile); err != nil {
+			return nil, nil
+		}
+		path = ConfigFile
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &Config{dir: filepath.Dir(path)}
+	err = json.NewDecoder(f).Decode(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// path resolves p relative to the directory of the config file.
+func (c *Config) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.dir, p)
+}
+
+// Apply copies settings from the config file to the command line
+// options.  Options set on the command line are left alone.
+func (c *Config) Apply(fs *flag.FlagSet) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	unset := func(names ...string) bool {
+		for _, n := range names {
+			if set[n] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if c.ImageDir != "" && unset("d", "dir") {
+		Dir = c.path(c.ImageDir)
+	}
+	if c.FontDir != "" && unset("font") {
+		Font = c.path(c.FontDir)
+	}
+	if c.GenDir != "" && unset("gen") {
+		Gen = c.path(c.GenDir)
+	}
+	if c.BuildDir != "" && unset("b") {
+		BuildDir = c.path(c.BuildDir)
+	}
+	if c.SrcRoot != "" && unset("src-root") {
+		SrcRoot = c.path(c.SrcRoot)
+	}
+	if len(c.Includes) > 0 && unset("p") {
+		paths := make([]string, len(c.Includes))
+		for i := range c.Includes {
+			paths[i] = c.path(c.Includes[i])
+		}
+		Includes = strings.Join(paths, ",")
+	}
+	if c.Style != "" && unset("s", "style") {
+		Style = c.Style
+	}
+	if c.Precision != 0 && unset("precision") {
+		Precision = c.Precision
+	}
+	if c.Comments != nil && unset("c", "comment") {
+		Comments = *c.Comments
+	}
+}
+
+// Files expands the entry globs.  The output directory of each entry
+// is recorded in Outputs.
+func (c *Config) Files() ([]string, error) {
+	var files []string
+	for _, e := range c.Entries {
+		matches, err := filepath.Glob(c.path(e.Glob))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if e.Output != "" {
+				Outputs[m] = c.path(e.Output)
+			}
+			files = append(files, m)
+		}
+	}
+	return files, nil
+}
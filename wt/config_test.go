@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeConfig writes a wellington.json holding cfg to a new directory.
+func writeConfig(t *testing.T, cfg string) string {
+	dir, err := ioutil.TempDir("", "wtconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ConfigFile)
+	if err := ioutil.WriteFile(path, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// parseFlags resets the compile options and parses args.
+func parseFlags(t *testing.T, args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	compileFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `{
+  "image_dir": "img",
+  "includes": ["sass", "vendor"],
+  "precision": 8,
+  "entries": [{"glob": "sass/*.scss", "output": "css"}]
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.dir != filepath.Dir(path) {
+		t.Errorf("got dir: %s wanted: %s", cfg.dir, filepath.Dir(path))
+	}
+	if cfg.ImageDir != "img" || cfg.Precision != 8 || len(cfg.Includes) != 2 {
+		t.Errorf("settings not read: %+v", cfg)
+	}
+	if e := (Entry{"sass/*.scss", "css"}); len(cfg.Entries) != 1 || cfg.Entries[0] != e {
+		t.Errorf("got entries: %v wanted: %v", cfg.Entries, e)
+	}
+
+	if _, err := loadConfig(filepath.Join(filepath.Dir(path), "missing.json")); err == nil {
+		t.Error("no error for a missing config")
+	}
+
+	bad := writeConfig(t, `{"precision": "8"}`)
+	defer os.RemoveAll(filepath.Dir(bad))
+	if _, err := loadConfig(bad); err == nil {
+		t.Error("no error for an invalid config")
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	path := writeConfig(t, `{
+  "image_dir": "img",
+  "build_dir": "build",
+  "src_root": "/abs/sass",
+  "includes": ["sass", "vendor"],
+  "style": "compressed",
+  "precision": 8
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	dir := filepath.Dir(path)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags set on the command line win over the config file
+	fs := parseFlags(t, "-b", "out", "-s", "expanded")
+	cfg.Apply(fs)
+
+	if e := "out"; BuildDir != e {
+		t.Errorf("got BuildDir: %s wanted: %s", BuildDir, e)
+	}
+	if e := "expanded"; Style != e {
+		t.Errorf("got Style: %s wanted: %s", Style, e)
+	}
+	if e := 8; Precision != e {
+		t.Errorf("got Precision: %d wanted: %d", Precision, e)
+	}
+
+	// Relative paths are resolved from the directory of the config
+	if e := filepath.Join(dir, "img"); Dir != e {
+		t.Errorf("got Dir: %s wanted: %s", Dir, e)
+	}
+	if e := filepath.Join(dir, "sass") + "," + filepath.Join(dir, "vendor"); Includes != e {
+		t.Errorf("got Includes: %s wanted: %s", Includes, e)
+	}
+	if e := "/abs/sass"; SrcRoot != e {
+		t.Errorf("got SrcRoot: %s wanted: %s", SrcRoot, e)
+	}
+
+	// Either name of a flag keeps the config value out
+	fs = parseFlags(t, "-style", "nested", "-d", "images")
+	cfg.Apply(fs)
+	if e := "nested"; Style != e {
+		t.Errorf("got Style: %s wanted: %s", Style, e)
+	}
+	if e := "images"; Dir != e {
+		t.Errorf("got Dir: %s wanted: %s", Dir, e)
+	}
+	if e := filepath.Join(dir, "build"); BuildDir != e {
+		t.Errorf("got BuildDir: %s wanted: %s", BuildDir, e)
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	path := writeConfig(t, `{
+  "entries": [
+    {"glob": "sass/pages/*.scss", "output": "css/pages"},
+    {"glob": "sass/*.scss"}
+  ]
+}`)
+	dir := filepath.Dir(path)
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"sass/main.scss", "sass/pages/a.scss", "sass/pages/b.scss"} {
+		f = filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Outputs = make(map[string]string)
+	defer func() { Outputs = make(map[string]string) }()
+	files, err := cfg.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	e := []string{
+		filepath.Join(dir, "sass/main.scss"),
+		filepath.Join(dir, "sass/pages/a.scss"),
+		filepath.Join(dir, "sass/pages/b.scss"),
+	}
+	if len(files) != len(e) {
+		t.Fatalf("got: %v wanted: %v", files, e)
+	}
+	for i := range e {
+		if files[i] != e[i] {
+			t.Errorf("got: %s wanted: %s", files[i], e[i])
+		}
+	}
+
+	// Only entries with an output are recorded
+	pages := filepath.Join(dir, "css/pages")
+	for _, f := range e[1:] {
+		if Outputs[f] != pages {
+			t.Errorf("%s got output: %s wanted: %s", f, Outputs[f], pages)
+		}
+	}
+	if out, ok := Outputs[e[0]]; ok {
+		t.Errorf("%s got output: %s wanted none", e[0], out)
+	}
+}
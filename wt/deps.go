@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sprite "github.com/wellington/wellington"
+)
+
+var cmdDeps = &Command{
+	Name:  "deps",
+	Flags: flag.NewFlagSet("deps", flag.ExitOnError),
+	Args:  "files...",
+	Short: "print the partials, images and fonts each stylesheet depends on",
+	Long: `Resolve the imports of each input file without compiling it and print
+every file it depends on.  Images and fonts are found from the literal
+arguments of sprite-map, image-url, inline-image and font-url.
+
+With -MD a Makefile dependency file is written next to the CSS of each
+input, ie. build/home.d for build/home.css.`,
+}
+
+var (
+	depsJSON bool
+	depsMD   bool
+)
+
+func init() {
+	fs := cmdDeps.Flags
+	cmdDeps.Run = runDeps
+	compileFlags(fs)
+	fs.BoolVar(&depsJSON, "json", false, "Print dependencies as JSON")
+	fs.BoolVar(&depsMD, "MD", false, "Write a Makefile .d file for each output CSS")
+}
+
+// Deps lists the files used to compile an entry.
+type Deps struct {
+	Entry    string   `json:"entry"`
+	Output   string   `json:"output,omitempty"`
+	Partials []string `json:"partials"`
+	Images   []string `json:"images"`
+	Fonts    []string `json:"fonts"`
+}
+
+// All returns the entry followed by every file it depends on.
+func (d Deps) All() []string {
+	all := []string{d.Entry}
+	all = append(all, d.Partials...)
+	all = append(all, d.Images...)
+	return append(all, d.Fonts...)
+}
+
+func runDeps(cmd *Command, args []string) int {
+	_, args = setup(cmd, args)
+	files := entries(args)
+	if len(files) == 0 {
+		cmd.Usage()
+		return 2
+	}
+
+	var all []Deps
+	for _, f := range files {
+		deps, err := findDeps(f)
+		if err != nil {
+			report(f, err)
+			continue
+		}
+		all = append(all, deps)
+
+		if depsMD {
+			err := writeDepfile(deps)
+			if err != nil {
+				report(f, err)
+			}
+		}
+		if !depsJSON {
+			printDeps(os.Stdout, deps)
+		}
+	}
+
+	if depsJSON {
+		printDepsJSON(os.Stdout, all)
+	}
+	if failed() > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printDeps writes the entry of deps followed by the files it depends
+// on, one per line.
+func printDeps(w io.Writer, deps Deps) {
+	fmt.Fprintf(w, "%s:\n", deps.Entry)
+	for _, d := range deps.All()[1:] {
+		fmt.Fprintf(w, "\t%s\n", d)
+	}
+}
+
+// printDepsJSON writes all as an indented JSON list.
+func printDepsJSON(w io.Writer, all []Deps) {
+	bs, _ := json.MarshalIndent(all, "", "  ")
+	fmt.Fprintln(w, string(bs))
+}
+
+// findDeps runs only the import pass of the parser on f.
+func findDeps(f string) (Deps, error) {
+	deps := Deps{
+		Entry:  f,
+		Output: outputPath(f),
+	}
+	ctx := newContext(f, filepath.Dir(deps.Output), nil, nil, 0)
+	fRead, err := os.Open(f)
+	if err != nil {
+		return deps, err
+	}
+	defer fRead.Close()
+
+	par, err := startParser(ctx, fRead, ioutil.Discard, filepath.Dir(Input))
+	if err != nil {
+		return deps, err
+	}
+	deps.Partials = unique(par.Imports)
+	deps.Images, deps.Fonts = refFiles(par, ctx.ImageDir, ctx.FontDir)
+	return deps, nil
+}
+
+// refFiles resolves the images and fonts referenced by the parsed
+// input.  Sprite globs are expanded to the images they match.
+func refFiles(par *sprite.Parser, imageDir, fontDir string) ([]string, []string) {
+	var imgs, fonts []string
+	for _, ref := range par.Refs() {
+		switch ref.Func {
+		case "font-url":
+			fonts = append(fonts, filepath.Join(fontDir, ref.Path))
+		case "sprite-map":
+			matches, _ := filepath.Glob(filepath.Join(imageDir, ref.Path))
+			imgs = append(imgs, matches...)
+		default:
+			imgs = append(imgs, filepath.Join(imageDir, ref.Path))
+		}
+	}
+	return unique(imgs), unique(fonts)
+}
+
+// writeDepfile writes a Makefile rule listing the dependencies of the
+// output CSS.  It fails when the CSS is written to stdout.
+func writeDepfile(deps Deps) error {
+	if deps.Output == "" {
+		return errors.New("-MD requires an output file, set the build directory with -b")
+	}
+	path := strings.TrimSuffix(deps.Output, ".css") + ".d"
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	all := deps.All()
+	lines := make([]string, len(all))
+	for i, d := range all {
+		lines[i] = strings.Replace(d, " ", `\ `, -1)
+	}
+	rule := fmt.Sprintf("%s: %s\n", strings.Replace(deps.Output, " ", `\ `, -1),
+		strings.Join(lines, " \\\n  "))
+	return ioutil.WriteFile(path, []byte(rule), 0644)
+}
+
+// unique sorts the paths removing duplicates.
+func unique(paths []string) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindDeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "icons"), 0755)
+	files := map[string]string{
+		"main.scss": `@import "one";
+div { background: image-url("x.png"); }`,
+		"_one.scss": `$map: sprite-map("icons/*.png");
+@font-face { src: font-url("f.ttf"); }`,
+		"icons/a.png": "",
+		"icons/b.png": "",
+		"x.png":       "",
+	}
+	for f, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, f), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { Dir, Font, BuildDir, SrcRoot, Includes = "", ".", "", "", "" }()
+	Dir, Font, Includes = "", filepath.Join(dir, "fonts"), ""
+	BuildDir, SrcRoot = filepath.Join(dir, "build"), dir
+
+	join := func(paths ...string) []string {
+		for i := range paths {
+			paths[i] = filepath.Join(dir, paths[i])
+		}
+		return paths
+	}
+	deps, err := findDeps(filepath.Join(dir, "main.scss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Deps{
+		Entry:    filepath.Join(dir, "main.scss"),
+		Output:   filepath.Join(dir, "build", "main.css"),
+		Partials: join("_one.scss"),
+		Images:   join("icons/a.png", "icons/b.png", "x.png"),
+		Fonts:    join("fonts/f.ttf"),
+	}
+	if !reflect.DeepEqual(deps, e) {
+		t.Errorf("got:\n%+v\nwanted:\n%+v", deps, e)
+	}
+}
+
+func TestPrintDeps(t *testing.T) {
+	deps := Deps{
+		Entry:    "sass/a.scss",
+		Partials: []string{"sass/_b.scss"},
+		Images:   []string{"img/x.png"},
+		Fonts:    []string{},
+	}
+	var buf bytes.Buffer
+	printDeps(&buf, deps)
+	e := "sass/a.scss:\n\tsass/_b.scss\n\timg/x.png\n"
+	if buf.String() != e {
+		t.Errorf("got:\n%s\nwanted:\n%s", buf.String(), e)
+	}
+
+	buf.Reset()
+	printDepsJSON(&buf, []Deps{deps})
+	e = `[
+  {
+    "entry": "sass/a.scss",
+    "partials": [
+      "sass/_b.scss"
+    ],
+    "images": [
+      "img/x.png"
+    ],
+    "fonts": []
+  }
+]
+`
+	if buf.String() != e {
+		t.Errorf("got:\n%s\nwanted:\n%s", buf.String(), e)
+	}
+}
+
+func TestWriteDepfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "build", "my page.css")
+	err = writeDepfile(Deps{
+		Entry:    "sass/my page.scss",
+		Output:   out,
+		Partials: []string{"sass/_b.scss"},
+		Images:   []string{"img/x.png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "build", "my page.d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spaces are escaped for make
+	e := filepath.Join(dir, "build", `my\ page.css`) + `: sass/my\ page.scss \
+  sass/_b.scss \
+  img/x.png
+`
+	if string(bs) != e {
+		t.Errorf("got:\n%s\nwanted:\n%s", bs, e)
+	}
+}
+
+func TestWriteDepfileStdout(t *testing.T) {
+	err := writeDepfile(Deps{Entry: "sass/a.scss"})
+	if err == nil {
+		t.Error("no error writing the dependencies of stdout")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/wellington/wellington/context"
+)
+
+var (
+	failMu   sync.Mutex
+	failures int
+)
+
+// report writes err in the format requested by -error-format and
+// records that f failed to compile.
+func report(f string, err error) {
+	failMu.Lock()
+	defer failMu.Unlock()
+	failures++
+
+	if ErrorFormat == "json" {
+		writeJSONError(os.Stderr, f, err)
+		return
+	}
+	log.Println(f)
+	log.Println(err)
+}
+
+// writeJSONError writes err as a line of JSON to w.  Errors that are
+// not from libsass are reported against f.
+func writeJSONError(w io.Writer, f string, err error) {
+	var cerr *context.CompileError
+	if !errors.As(err, &cerr) {
+		cerr = &context.CompileError{File: f, Partial: f, Message: err.Error()}
+	}
+	bs, _ := json.Marshal(struct {
+		Entry string `json:"entry"`
+		*context.CompileError
+	}{f, cerr})
+	fmt.Fprintln(w, string(bs))
+}
+
+// failed returns the number of entries that failed to compile.
+func failed() int {
+	failMu.Lock()
+	defer failMu.Unlock()
+	return failures
+}
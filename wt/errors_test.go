@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/wellington/wellington/context"
+)
+
+func TestWriteJSONError(t *testing.T) {
+	cerr := &context.CompileError{
+		File:        "stdin",
+		Line:        5,
+		Column:      3,
+		Message:     "Undefined variable",
+		Partial:     "sass/_vars.scss",
+		PartialLine: 2,
+		Lines:       []string{"  color: $blue;"},
+		FirstLine:   5,
+	}
+	tests := []struct {
+		name string
+		err  error
+		e    string
+	}{
+		{"compile", cerr, `{"entry":"sass/a.scss","file":"stdin","line":5,"column":3,"message":"Undefined variable","partial":"sass/_vars.scss","partial_line":2,"lines":["  color: $blue;"],"first_line":5}`},
+		{"wrapped", fmt.Errorf("compile: %w", cerr), `{"entry":"sass/a.scss","file":"stdin","line":5,"column":3,"message":"Undefined variable","partial":"sass/_vars.scss","partial_line":2,"lines":["  color: $blue;"],"first_line":5}`},
+		{"other", errors.New("open sass/a.scss: no such file"), `{"entry":"sass/a.scss","file":"sass/a.scss","line":0,"column":0,"message":"open sass/a.scss: no such file","partial":"sass/a.scss","partial_line":0}`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		writeJSONError(&buf, "sass/a.scss", test.err)
+		if e := test.e + "\n"; buf.String() != e {
+			t.Errorf("%s got:\n%s\nwanted:\n%s", test.name, buf.String(), e)
+		}
+	}
+}
+
+func TestReportCounts(t *testing.T) {
+	before := failed()
+	ErrorFormat = "text"
+	report("a.scss", errors.New("failed"))
+	report("b.scss", errors.New("failed"))
+	if e := before + 2; failed() != e {
+		t.Errorf("got: %d wanted: %d", failed(), e)
+	}
+}
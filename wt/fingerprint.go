@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FingerprintFile is written to the build directory when -fingerprint
+// is set.  It maps the CSS and source map names to the fingerprinted
+// names.
+//
+//	{
+//	  "home.css": "home-3f9a1c.css",
+//	  "home.css.map": "home-8d02e4.css.map"
+//	}
+const FingerprintFile = "fingerprints.json"
+
+// Fingerprints collects the names of fingerprinted stylesheets.
+type Fingerprints struct {
+	path  string
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// NewFingerprints returns a mapping file written to path.
+func NewFingerprints(path string) *Fingerprints {
+	return &Fingerprints{
+		path:  path,
+		names: make(map[string]string),
+	}
+}
+
+// fingerprintPath adds the hash of bs to the file name of path, ie.
+// build/home.css becomes build/home-3f9a1c.css.  Source maps keep
+// their .css.map extension.
+func fingerprintPath(path string, bs []byte) string {
+	sum := sha1.Sum(bs)
+	ext := filepath.Ext(path)
+	if strings.HasSuffix(path, ".css.map") {
+		ext = ".css.map"
+	}
+	return strings.TrimSuffix(path, ext) + "-" +
+		hex.EncodeToString(sum[:])[:6] + ext
+}
+
+// Add records that the file name was written to hashed.
+func (f *Fingerprints) Add(name, hashed string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.names[f.rel(name)] = f.rel(hashed)
+}
+
+// rel makes path relative to the directory of the mapping file.
+func (f *Fingerprints) rel(path string) string {
+	abs, _ := filepath.Abs(path)
+	dir, _ := filepath.Abs(filepath.Dir(f.path))
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// Write saves the mapping of every stylesheet added so far.
+func (f *Fingerprints) Write() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bs, err := json.MarshalIndent(f.names, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(f.path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.path, bs, 0644)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFingerprintPath(t *testing.T) {
+	// The sha1 of "div{}" starts with 8e2470
+	bs := []byte("div{}")
+	tests := []struct {
+		path, e string
+	}{
+		{"build/home.css", "build/home-8e2470.css"},
+		{"build/home.css.map", "build/home-8e2470.css.map"},
+		{"build/v1.2/home.css", "build/v1.2/home-8e2470.css"},
+	}
+	for _, test := range tests {
+		if got := fingerprintPath(test.path, bs); got != test.e {
+			t.Errorf("got: %s wanted: %s", got, test.e)
+		}
+	}
+	if fingerprintPath("home.css", []byte("p{}")) == fingerprintPath("home.css", bs) {
+		t.Error("different contents have the same fingerprint")
+	}
+}
+
+func TestFingerprintsWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "build", FingerprintFile)
+
+	f := NewFingerprints(path)
+	// Names are relative to the mapping file
+	f.Add(filepath.Join(dir, "build/home.css"), filepath.Join(dir, "build/home-8e2470.css"))
+	f.Add(filepath.Join(dir, "build/pages/a.css"), filepath.Join(dir, "build/pages/a-000000.css"))
+	if err := f.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(bs, &got); err != nil {
+		t.Fatal(err)
+	}
+	e := map[string]string{
+		"home.css":    "home-8e2470.css",
+		"pages/a.css": "pages/a-000000.css",
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("got: %v wanted: %v", got, e)
+	}
+}
@@ -1,17 +1,21 @@
 // Main package wraps sprite_sass tool for use with the command line
-// See -h for list of available options
+// Run "wt help" for the list of commands and their options
 package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync"
 
 	"github.com/wellington/spritewell"
 	sprite "github.com/wellington/wellington"
@@ -26,38 +30,260 @@ var (
 	MainFile, Style                 string
 	Comments                        bool
 	cpuprofile                      string
-	Help, ShowVersion               bool
-	BuildDir                        string
+	ShowVersion                     bool
+	BuildDir, SrcRoot               string
+	HTTP, ConfigPath                string
+	CachePath, ManifestPath         string
+	Fingerprint                     bool
+	ErrorFormat                     string
+	SourceMap, SourceMapInline      bool
+	SourceMapContents               bool
+	Jobs, Precision                 int
+
+	// buildCache is used to skip unchanged entries when -cache is set
+	buildCache *BuildCache
+	// manifest lists the files written when -manifest is set
+	manifest *Manifest
+	// fingerprints maps CSS names to hashed names when -fingerprint is set
+	fingerprints *Fingerprints
+
+	// Outputs maps input files to the directory their CSS is
+	// written to, overriding the build directory.
+	Outputs = make(map[string]string)
+
+	// compileWatch and compileHTTP keep wt -watch and wt -http
+	// working, they run the watch and serve commands.
+	compileWatch bool
+	compileHTTP  string
 )
 
+// Command is a wt subcommand with its own set of flags.
+type Command struct {
+	// Name is used to select the command ie. wt compile
+	Name string
+	// Args describes the arguments following the flags
+	Args string
+	// Short is the description shown in the list of commands
+	Short string
+	// Long is the description shown in the help for the command
+	Long  string
+	Flags *flag.FlagSet
+	// Run executes the command returning the exit code
+	Run func(cmd *Command, args []string) int
+}
+
+// Usage prints the help for the command.
+func (c *Command) Usage() {
+	fmt.Fprintf(os.Stderr, "usage: wt %s [options] %s\n\n%s\n\nOptions:\n",
+		c.Name, c.Args, c.Long)
+	c.Flags.PrintDefaults()
+	if c == cmdCompile {
+		printCommands()
+	}
+}
+
+// commands is the list of available subcommands.  compile is the
+// default when no command is specified.
+var commands = []*Command{
+	cmdCompile,
+	cmdDeps,
+	cmdWatch,
+	cmdServe,
+	cmdSprite,
+}
+
+var cmdCompile = &Command{
+	Name:  "compile",
+	Flags: flag.NewFlagSet("compile", flag.ExitOnError),
+	Args:  "[files...]",
+	Short: "compile stylesheets to CSS",
+	Long: `Compile the input files to CSS.  Output is written to the build
+directory or stdout when one is not set.  Input is read from stdin when
+no files are specified.`,
+}
+
 func init() {
-	flag.BoolVar(&ShowVersion, "version", false, "Show the app version")
+	for _, cmd := range commands {
+		cmd.Flags.Usage = cmd.Usage
+	}
+
+	fs := cmdCompile.Flags
+	cmdCompile.Run = runCompile
+	fs.BoolVar(&ShowVersion, "version", false, "Show the app version")
+	compileFlags(fs)
+	fs.IntVar(&Jobs, "j", 1, "Number of files to compile at the same time")
+	fs.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to file")
+	fs.BoolVar(&compileWatch, "watch", false, "Same as wt watch")
+	fs.BoolVar(&compileWatch, "w", false, "Same as wt watch")
+	fs.StringVar(&compileHTTP, "http", "", "Same as wt serve -http")
+}
 
-	flag.BoolVar(&Help, "help", false, "this help")
-	flag.BoolVar(&Help, "h", false, "this help")
+// compileFlags registers the options shared by commands that compile
+// stylesheets.
+func compileFlags(fs *flag.FlagSet) {
+	fs.StringVar(&BuildDir, "b", "", "Build Directory")
+	fs.StringVar(&SrcRoot, "src-root", "", "Directory mirrored into the build directory, defaults to the current directory")
+	fs.StringVar(&Gen, "gen", ".", "Directory for generated images")
 
-	flag.StringVar(&BuildDir, "b", "", "Build Directory")
-	flag.StringVar(&Gen, "gen", ".", "Directory for generated images")
+	fs.StringVar(&Includes, "p", "", "SASS import paths separated by commas")
+	fs.StringVar(&Dir, "dir", "", "Image directory")
+	fs.StringVar(&Dir, "d", "", "Image directory")
+	fs.StringVar(&Font, "font", ".", "Font Directory")
 
-	flag.StringVar(&Includes, "p", "", "SASS import path")
-	flag.StringVar(&Dir, "dir", "", "Image directory")
-	flag.StringVar(&Dir, "d", "", "Image directory")
-	flag.StringVar(&Font, "font", ".", "Font Directory")
+	fs.StringVar(&Style, "style", "nested", "CSS nested style")
+	fs.StringVar(&Style, "s", "nested", "CSS nested style")
+	fs.BoolVar(&Comments, "comment", true, "Turn on source comments")
+	fs.BoolVar(&Comments, "c", true, "Turn on source comments")
+	fs.IntVar(&Precision, "precision", 5, "Precision of decimal numbers")
 
-	flag.StringVar(&Style, "style", "nested", "CSS nested style")
-	flag.StringVar(&Style, "s", "nested", "CSS nested style")
-	flag.BoolVar(&Comments, "comment", true, "Turn on source comments")
-	flag.BoolVar(&Comments, "c", true, "Turn on source comments")
+	fs.StringVar(&ConfigPath, "config", "", "Project file, defaults to "+ConfigFile)
+	fs.BoolVar(&SourceMap, "sourcemap", false, "Write a source map next to each CSS file")
+	fs.BoolVar(&SourceMapInline, "sourcemap-inline", false, "Embed the source map in the CSS")
+	fs.BoolVar(&SourceMapContents, "sourcemap-contents", false, "Include the original sources in the source map")
+	fs.StringVar(&ErrorFormat, "error-format", "text", "Format of compile errors: text or json")
+	fs.StringVar(&CachePath, "cache", "", "Only compile files that changed since the last build, state is kept in this directory ie. "+CacheDir)
+	fs.StringVar(&ManifestPath, "manifest", "", "Write a JSON list of the CSS and sprites created, ie. manifest.json")
+	fs.BoolVar(&Fingerprint, "fingerprint", false, "Add the content hash to CSS and source map file names in the build directory, the names are listed in "+FingerprintFile)
+}
+
+func printCommands() {
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.Name, cmd.Short)
+	}
+	fmt.Fprintln(os.Stderr, "\nUse \"wt help [command]\" for more information about a command.")
+}
 
-	flag.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to file")
+func lookupCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
 }
 
 func main() {
-	flag.Parse()
+	// Deferred first so that it runs after every other deferred call
+	var exitCode int
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// Without a command, arguments are passed to compile
+	cmd, args := cmdCompile, os.Args[1:]
+	if len(args) > 0 {
+		if args[0] == "help" {
+			if len(args) > 1 && lookupCommand(args[1]) != nil {
+				lookupCommand(args[1]).Usage()
+				return
+			}
+			cmdCompile.Usage()
+			return
+		}
+		if c := lookupCommand(args[0]); c != nil {
+			cmd, args = c, args[1:]
+		}
+	}
+	cmd.Flags.Parse(args)
+	exitCode = cmd.Run(cmd, cmd.Flags.Args())
+}
+
+// setup applies the project file and validates options shared by the
+// compiling commands.  It returns the libsass output style and the
+// files to compile.
+func setup(cmd *Command, args []string) (int, []string) {
+	cfg, err := loadConfig(ConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg != nil {
+		cfg.Apply(cmd.Flags)
+	}
+
+	if Jobs < 1 {
+		Jobs = 1
+	}
+	if Jobs > runtime.GOMAXPROCS(0) {
+		runtime.GOMAXPROCS(Jobs)
+	}
+
+	for _, v := range args {
+		if strings.HasPrefix(v, "-") {
+			log.Fatalf("Please specify flags before other arguments: %s", v)
+		}
+	}
+
+	if Gen != "" {
+		err := os.MkdirAll(Gen, 0755)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	style, ok := context.Style[Style]
+
+	if !ok {
+		style = context.NESTED_STYLE
+	}
+
+	if CachePath != "" {
+		buildCache, err = NewBuildCache(CachePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if ManifestPath != "" {
+		manifest = NewManifest(ManifestPath)
+	}
+	if Fingerprint {
+		if BuildDir == "" {
+			log.Fatal("-fingerprint requires a build directory, set it with -b")
+		}
+		fingerprints = NewFingerprints(filepath.Join(BuildDir, FingerprintFile))
+	}
+
+	if len(args) == 0 && cfg != nil && len(cfg.Entries) > 0 {
+		args, err = cfg.Files()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return style, args
+}
+
+// entries removes partials from the list of files
+func entries(args []string) []string {
+	var files []string
+	for _, f := range args {
+		// Remove partials
+		if strings.HasPrefix(filepath.Base(f), "_") {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func newCache() *spritewell.SafeImageMap {
+	return &spritewell.SafeImageMap{
+		M: make(map[string]spritewell.ImageList, 100)}
+}
 
+func runCompile(cmd *Command, args []string) int {
 	if ShowVersion {
 		fmt.Println(version)
-		os.Exit(0)
+		return 0
+	}
+	if compileWatch {
+		return runWatch(cmd, args)
+	}
+	if compileHTTP != "" {
+		HTTP = compileHTTP
+		return runServe(cmd, args)
 	}
 
 	// Profiling code
@@ -78,144 +304,340 @@ func main() {
 		}()
 	}
 
-	for _, v := range flag.Args() {
-		if strings.HasPrefix(v, "-") {
-			log.Fatalf("Please specify flags before other arguments: %s", v)
+	style, args := setup(cmd, args)
+
+	if len(args) == 0 {
+		// Read from stdin
+		log.Print("Reading from stdin, -h for help")
+		out := os.Stdout
+		in := os.Stdin
+
+		var pout bytes.Buffer
+		ctx := context.Context{OnWarning: printWarning("stdin")}
+		par, err := startParser(&ctx, in, &pout, "")
+		if err != nil {
+			report("stdin", err)
+		}
+		ctx.LookupPosition = par.LookupPosition
+		err = ctx.Compile(&pout, out)
+
+		if err != nil {
+			report("stdin", err)
 		}
 	}
 
-	if Help {
-		fmt.Println("Please specify input filepath.")
-		fmt.Println("\nAvailable options:")
-		flag.PrintDefaults()
-		return
+	files := entries(args)
+	if err := checkOutputs(files); err != nil {
+		log.Fatal(err)
 	}
+	compileAll(files, newCache(), newCache(), style)
 
-	if Gen != "" {
-		err := os.MkdirAll(Gen, 0755)
+	if n := failed(); n > 0 {
+		log.Printf("%d file(s) failed to compile", n)
+		return 1
+	}
+	return 0
+}
+
+// compileAll compiles files using Jobs workers.  The sprite and image
+// caches are shared by all workers.  Parsers are returned in the same
+// order as files.  The manifest and fingerprints are only written
+// when files is not empty.
+func compileAll(files []string, sprites, imgs *spritewell.SafeImageMap, style int) []*sprite.Parser {
+	pars := make([]*sprite.Parser, len(files))
+	if len(files) == 0 {
+		return pars
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < Jobs; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				pars[i] = compile(files[i], sprites, imgs, style)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if manifest != nil {
+		err := manifest.Write()
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Failed to write manifest: %s", err)
+		}
+	}
+	if fingerprints != nil {
+		err := fingerprints.Write()
+		if err != nil {
+			log.Printf("Failed to write %s: %s", FingerprintFile, err)
 		}
 	}
+	return pars
+}
 
-	style, ok := context.Style[Style]
+// compile builds the CSS for a single input file.  The returned parser
+// is used to discover the files that were imported.
+func compile(f string, sprites, imgs *spritewell.SafeImageMap, style int) *sprite.Parser {
+	// log.Println("Open:", f)
 
-	if !ok {
-		style = context.NESTED_STYLE
-	}
+	var out io.Writer = os.Stdout
+	fout := outputPath(f)
 
-	if len(flag.Args()) == 0 {
-		// Read from stdin
-		log.Print("Reading from stdin, -h for help")
-		out := os.Stdout
-		in := os.Stdin
+	if buildCache != nil {
+		if rec, ok := buildCache.Fresh(f, fout); ok {
+			added(f, fout, rec.CSS, rec.Map, rec.Sprites)
+			return &sprite.Parser{Imports: rec.Partials}
+		}
+	}
 
-		var pout bytes.Buffer
-		ctx := context.Context{}
-		_, err := startParser(&ctx, in, &pout, "")
+	var buf bytes.Buffer
+	fingerprint := Fingerprint && fout != ""
+	if fout != "" {
+		dir := filepath.Dir(fout)
+		err := os.MkdirAll(dir, 0755)
 		if err != nil {
-			log.Println(err)
+			report(f, fmt.Errorf("Failed to create directory: %s", err))
+			return &sprite.Parser{}
 		}
-		err = ctx.Compile(&pout, out)
-
+	}
+	if fingerprint {
+		// The file name is known once the CSS is compiled
+		out = &buf
+	} else if fout != "" {
+		fw, err := os.Create(fout)
 		if err != nil {
-			log.Println(err)
+			report(f, fmt.Errorf("Failed to create file: %s", err))
+			return &sprite.Parser{}
 		}
+		defer fw.Close()
+		out = fw
+		// log.Println("Created:", fout)
 	}
 
-	SpriteCache := spritewell.SafeImageMap{
-		M: make(map[string]spritewell.ImageList, 100)}
-	ImageCache := spritewell.SafeImageMap{
-		M: make(map[string]spritewell.ImageList, 100)}
-
-	for _, f := range flag.Args() {
-		// Remove partials
-		if strings.HasPrefix(filepath.Base(f), "_") {
-			continue
+	par, ctx, err := build(f, out, fout, sprites, imgs, style)
+	if err != nil {
+		report(f, err)
+		return par
+	}
+	css := fout
+	if fingerprint {
+		css = fingerprintPath(fout, buf.Bytes())
+		err := ioutil.WriteFile(css, buf.Bytes(), 0644)
+		if err != nil {
+			report(f, err)
+			return par
 		}
-		// log.Println("Open:", f)
-
-		// If no imagedir specified, assume relative to the input file
-		if Dir == "" {
-			Dir = filepath.Dir(f)
-		}
-		var (
-			out  io.WriteCloser
-			fout string
-		)
-		if BuildDir != "" {
-			// Build output file based off build directory and input filename
-			rel, _ := filepath.Rel(Includes, filepath.Dir(f))
-			filename := strings.Replace(filepath.Base(f), ".scss", ".css", 1)
-			fout = filepath.Join(BuildDir, rel, filename)
-		} else {
-			out = os.Stdout
-		}
-
-		ctx := context.Context{
-			// TODO: Most of these fields are no longer used
-			Sprites:     SpriteCache,
-			Imgs:        ImageCache,
-			OutputStyle: style,
-			ImageDir:    Dir,
-			FontDir:     Font,
-			// Assumption that output is a file
-			BuildDir:     filepath.Dir(fout),
-			GenImgDir:    Gen,
-			MainFile:     f,
-			Comments:     Comments,
-			IncludePaths: []string{filepath.Dir(f)},
-		}
-		if Includes != "" {
-			ctx.IncludePaths = append(ctx.IncludePaths,
-				strings.Split(Includes, ",")...)
-		}
-		fRead, err := os.Open(f)
-		defer fRead.Close()
+	}
+	var sourceMap string
+	if SourceMap && !SourceMapInline && fout != "" {
+		sourceMap = ctx.Map
+	}
+	spriteOuts := spriteFiles(ctx)
+	added(f, fout, css, sourceMap, spriteOuts)
+	if buildCache != nil && fout != "" {
+		err := buildCache.Save(f, fout, css, sourceMap, par, ctx, spriteOuts)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Failed to update build cache: %s", err)
 		}
-		if fout != "" {
-			dir := filepath.Dir(fout)
-			err := os.MkdirAll(dir, 0755)
-			if err != nil {
-				log.Fatalf("Failed to create directory: %s", dir)
-			}
+	}
+	return par
+}
 
-			out, err = os.Create(fout)
-			defer out.Close()
-			if err != nil {
-				log.Fatalf("Failed to create file: %s", f)
-			}
-			// log.Println("Created:", fout)
+// added records the files created for f in the manifest and the
+// fingerprint mapping.  css is the file the CSS for fout was written to
+// and sourceMap its source map file, if any.
+func added(f, fout, css, sourceMap string, sprites []string) {
+	if manifest != nil {
+		manifest.Add(f, css, sourceMap, sprites)
+	}
+	if fingerprints != nil && fout != "" {
+		fingerprints.Add(fout, css)
+		if sourceMap != "" {
+			fingerprints.Add(fout+".map", sourceMap)
 		}
+	}
+}
 
-		var pout bytes.Buffer
-		par, err := startParser(&ctx, fRead, &pout, filepath.Dir(Input))
-		if err != nil {
-			log.Println(err)
+// outputPath returns the path the CSS for f is written to.  An empty
+// path means the CSS is written to stdout.
+func outputPath(f string) string {
+	filename := filepath.Base(f)
+	filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".css"
+	if dir, ok := Outputs[f]; ok {
+		return filepath.Join(dir, filename)
+	} else if BuildDir != "" {
+		// Build output file based off build directory and input filename
+		return filepath.Join(BuildDir, srcRel(f), filename)
+	}
+	return ""
+}
+
+// srcRel returns the directory of f relative to the source root.  Files
+// outside of the source root are written to the top of the build
+// directory.
+func srcRel(f string) string {
+	src := srcRoot()
+	root, _ := filepath.Abs(src)
+	dir, _ := filepath.Abs(filepath.Dir(f))
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		log.Printf("%s is outside of the source root %s", f, src)
+		return ""
+	}
+	return rel
+}
+
+// srcRoot is SrcRoot or, when it is not set, the current directory.
+// Import paths only affect how imports are found.
+func srcRoot() string {
+	if SrcRoot != "" {
+		return SrcRoot
+	}
+	return "."
+}
+
+// checkOutputs fails when two files would write the same CSS file.
+func checkOutputs(files []string) error {
+	seen := make(map[string]string, len(files))
+	for _, f := range files {
+		fout := outputPath(f)
+		if fout == "" {
 			continue
 		}
-		err = ctx.Compile(&pout, out)
+		if prev, ok := seen[fout]; ok {
+			return fmt.Errorf("%s and %s are both written to %s", prev, f, fout)
+		}
+		seen[fout] = f
+	}
+	return nil
+}
+
+// newContext creates the Context used to compile f with the options
+// from the command line.
+func newContext(f string, buildDir string, sprites, imgs *spritewell.SafeImageMap, style int) *context.Context {
+	ctx := &context.Context{
+		// TODO: Most of these fields are no longer used
+		Sprites:      sprites,
+		Imgs:         imgs,
+		OutputStyle:  style,
+		Precision:    Precision,
+		ImageDir:     imageDir(f),
+		FontDir:      Font,
+		BuildDir:     buildDir,
+		GenImgDir:    Gen,
+		CacheDir:     CachePath,
+		MainFile:     f,
+		Comments:     Comments,
+		IncludePaths: []string{filepath.Dir(f)},
+	}
+	if Includes != "" {
+		ctx.IncludePaths = append(ctx.IncludePaths,
+			strings.Split(Includes, ",")...)
+	}
+	ctx.OnWarning = printWarning(f)
+	return ctx
+}
+
+// printWarning returns a function printing the warnings of the input
+// f to stderr, so they are never mixed with CSS written to stdout.
+func printWarning(f string) func(context.Warning) {
+	return func(w context.Warning) {
+		if w.File == "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", f, w)
+			return
+		}
+		fmt.Fprintln(os.Stderr, w)
+	}
+}
 
+// imageDir is the image directory used to compile f.  If no image
+// directory is specified, images are relative to the input file.
+func imageDir(f string) string {
+	if Dir == "" {
+		return filepath.Dir(f)
+	}
+	return Dir
+}
+
+// build parses and compiles f writing the CSS to out.  fout is the
+// path the CSS is served from, it is used to create relative paths to
+// images and fonts.  An empty fout means the CSS is written to stdout.
+// The Context lists the files and sprites used by the compile.
+func build(f string, out io.Writer, fout string, sprites, imgs *spritewell.SafeImageMap, style int) (*sprite.Parser, *context.Context, error) {
+	// Assumption that output is a file
+	ctx := newContext(f, filepath.Dir(fout), sprites, imgs, style)
+	maps := SourceMap || SourceMapInline
+	if maps {
+		ctx.Out = fout
+		ctx.Map = fout + ".map"
+		ctx.MapContents = SourceMapContents
+		// The sourceMappingURL is added by writeSourceMap
+		ctx.MapOmitURL = true
+	}
+	fRead, err := os.Open(f)
+	if err != nil {
+		return &sprite.Parser{}, ctx, err
+	}
+	defer fRead.Close()
+
+	// The parser finds the imports and images, libsass reads the file
+	par, err := startParser(ctx, fRead, ioutil.Discard, filepath.Dir(Input))
+	if err != nil {
+		return par, ctx, err
+	}
+	err = ctx.CompileFile(f, out)
+
+	if err != nil {
+		return par, ctx, err
+	}
+	if maps {
+		return par, ctx, writeSourceMap(ctx, out, SourceMapInline || fout == "")
+	}
+	return par, ctx, nil
+}
+
+// writeSourceMap adds the sourceMappingURL comment for the source map
+// of ctx to out.  The map is embedded in the comment when inline is
+// true, otherwise it is written next to the CSS.
+func writeSourceMap(ctx *context.Context, out io.Writer, inline bool) error {
+	bs := []byte(ctx.SourceMap())
+	url := filepath.Base(ctx.Map)
+	if inline {
+		url = "data:application/json;base64," +
+			base64.StdEncoding.EncodeToString(bs)
+	} else {
+		if Fingerprint {
+			// The hash of the CSS includes this URL, so the map
+			// is named after its own contents.
+			ctx.Map = fingerprintPath(ctx.Map, bs)
+			url = filepath.Base(ctx.Map)
+		}
+		err := ioutil.WriteFile(ctx.Map, bs, 0644)
 		if err != nil {
-			log.Println(ctx.MainFile)
-			n := ctx.ErrorLine()
-			fs := par.LookupFile(n)
-			log.Printf("Error encountered in: %s\n", fs)
-			log.Println(err)
+			return err
 		}
 	}
+	_, err := fmt.Fprintf(out, "\n/*# sourceMappingURL=%s */\n", url)
+	return err
 }
 
 func startParser(ctx *context.Context, in io.Reader, out io.Writer, pkgdir string) (*sprite.Parser, error) {
 	// Run the sprite_sass parser prior to passing to libsass
 	parser := &sprite.Parser{
-		ImageDir: ctx.ImageDir,
-		Includes: ctx.IncludePaths,
-		BuildDir: ctx.BuildDir,
-		MainFile: ctx.MainFile,
+		ImageDir:    ctx.ImageDir,
+		Includes:    ctx.IncludePaths,
+		BuildDir:    ctx.BuildDir,
+		MainFile:    ctx.MainFile,
+		KeepImports: true,
+		ToSCSS:      context.ToSCSS,
 	}
+	ctx.Importers = append(ctx.Importers, importer(parser))
 	// Save reference to parser in context
 	bs, err := parser.Start(in, pkgdir)
 	if err != nil {
@@ -224,3 +646,27 @@ func startParser(ctx *context.Context, in io.Reader, out io.Writer, pkgdir strin
 	out.Write(bs)
 	return parser, err
 }
+
+// importer resolves imports for libsass with the rules of the parser.
+// Plain CSS imports, and imports the parser can not find, are left to
+// libsass which reports them when they are missing.
+func importer(par *sprite.Parser) context.ImportFunc {
+	return func(ctx *context.Context, url, prev string) (string, []byte, error) {
+		if cssImport(url) {
+			return "", nil, context.ErrSkipImport
+		}
+		path, contents, err := par.Import(url, prev)
+		if err != nil {
+			return "", nil, context.ErrSkipImport
+		}
+		return path, contents, nil
+	}
+}
+
+func cssImport(url string) bool {
+	return strings.HasSuffix(url, ".css") ||
+		strings.HasPrefix(url, "http://") ||
+		strings.HasPrefix(url, "https://") ||
+		strings.HasPrefix(url, "//") ||
+		strings.HasPrefix(url, "url(")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	sprite "github.com/wellington/wellington"
+	"github.com/wellington/wellington/context"
+)
+
+func TestImporterSkipsMissing(t *testing.T) {
+	par := &sprite.Parser{}
+	imp := importer(par)
+	for _, url := range []string{"missing", "missing.scss", "reset.css"} {
+		_, _, err := imp(nil, url, "stdin")
+		if err != context.ErrSkipImport {
+			t.Errorf("%s: got %v wanted ErrSkipImport", url, err)
+		}
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	defer func() {
+		BuildDir, SrcRoot, Includes = "", "", ""
+		Outputs = make(map[string]string)
+	}()
+	tests := []struct {
+		name                       string
+		build, root, includes, out string
+		file, e                    string
+	}{
+		{"stdout", "", "", "", "", "sass/a.scss", ""},
+		{"src-root", "build", "sass", "", "", "sass/pages/a.scss", "build/pages/a.css"},
+		{"src-root wins", "build", "sass", "vendor", "", "sass/pages/a.scss", "build/pages/a.css"},
+		{"single -p", "build", "", "sass", "", "sass/pages/a.scss", "build/sass/pages/a.css"},
+		{"other -p", "build", "", "vendor", "", "sass/pages/a.scss", "build/sass/pages/a.css"},
+		{"several -p", "build", "", "sass,vendor", "", "sass/pages/a.scss", "build/sass/pages/a.css"},
+		{"no root", "build", "", "", "", "sass/a.sass", "build/sass/a.css"},
+		{"outside root", "build", "sass", "", "", "other/a.scss", "build/a.css"},
+		{"outside parent", "build", "sass", "", "", "../a.scss", "build/a.css"},
+		{"entry output", "build", "sass", "", "css", "sass/pages/a.scss", "css/a.css"},
+	}
+	for _, test := range tests {
+		BuildDir, SrcRoot, Includes = test.build, test.root, test.includes
+		Outputs = make(map[string]string)
+		if test.out != "" {
+			Outputs[test.file] = test.out
+		}
+		if got := outputPath(test.file); got != filepath.FromSlash(test.e) {
+			t.Errorf("%s: got %q wanted %q", test.name, got, test.e)
+		}
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	defer func() { BuildDir, SrcRoot, Includes = "", "", "" }()
+	tests := []struct {
+		name        string
+		build, root string
+		files       []string
+		clash       bool
+	}{
+		{"stdout", "", "sass", []string{"sass/a.scss", "other/a.scss"}, false},
+		{"mirrored", "build", "sass", []string{"sass/a.scss", "sass/pages/a.scss"}, false},
+		{"outside root", "build", "sass", []string{"sass/a.scss", "other/a.scss"}, true},
+		{"same name", "build", "", []string{"a.scss", "a.sass"}, true},
+	}
+	for _, test := range tests {
+		BuildDir, SrcRoot, Includes = test.build, test.root, ""
+		err := checkOutputs(test.files)
+		if test.clash && err == nil {
+			t.Errorf("%s: no error for %v", test.name, test.files)
+		}
+		if !test.clash && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/wellington/wellington/context"
+)
+
+// Manifest lists the files written by a build.  It is saved as JSON
+// so deploy tools know which files to upload.
+//
+//	{
+//	  "files": [
+//	    {"path": "build/home.css", "type": "css", "entry": "sass/home.scss", ...},
+//	    {"path": "img/sprites-b798ab.png", "type": "sprite", "entry": "sass/home.scss", ...}
+//	  ]
+//	}
+type Manifest struct {
+	Files []Artifact `json:"files"`
+
+	path    string
+	mu      sync.Mutex
+	outputs map[string]entryOutputs
+}
+
+// Artifact is a file created while compiling Entry.  Sprites shared by
+// several entries are attributed to the first entry in sorted order.
+type Artifact struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Hash  string `json:"hash"`
+	Size  int64  `json:"size"`
+	Entry string `json:"entry"`
+}
+
+// entryOutputs are the CSS, source map and sprites created for an
+// entry.
+type entryOutputs struct {
+	css, sourceMap string
+	sprites        []string
+}
+
+// NewManifest returns a manifest that is written to path.
+func NewManifest(path string) *Manifest {
+	return &Manifest{
+		path:    path,
+		outputs: make(map[string]entryOutputs),
+	}
+}
+
+// Add records the files created for entry, sourceMap is empty when no
+// source map file was written.  Entries compiled again replace their
+// previous files.
+func (m *Manifest) Add(entry, css, sourceMap string, sprites []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outputs[entry] = entryOutputs{css: css, sourceMap: sourceMap, sprites: sprites}
+}
+
+// Write saves the manifest for every entry added so far.
+func (m *Manifest) Write() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []string
+	for entry := range m.outputs {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	m.Files = m.Files[:0]
+	seen := make(map[string]bool)
+	add := func(path, typ, entry string) {
+		if path == "" || seen[path] {
+			return
+		}
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		m.Files = append(m.Files, Artifact{
+			Path:  filepath.ToSlash(path),
+			Type:  typ,
+			Hash:  hashFile(path),
+			Size:  info.Size(),
+			Entry: entry,
+		})
+	}
+	for _, entry := range entries {
+		out := m.outputs[entry]
+		add(out.css, "css", entry)
+		add(out.sourceMap, "sourcemap", entry)
+		for _, s := range out.sprites {
+			add(s, "sprite", entry)
+		}
+	}
+
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(m.path); dir != "." {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(m.path, bs, 0644)
+}
+
+// spriteFiles returns the sprite images used by the compile of ctx.
+func spriteFiles(ctx *context.Context) []string {
+	var files []string
+	ctx.Sprites.RLock()
+	defer ctx.Sprites.RUnlock()
+	for _, key := range ctx.IncludedSprites() {
+		path, err := ctx.Sprites.M[key].OutputPath()
+		if err == nil {
+			files = append(files, filepath.Join(ctx.GenImgDir, path))
+		}
+	}
+	return unique(files)
+}
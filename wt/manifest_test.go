@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := func(f string) string {
+		return filepath.Join(dir, f)
+	}
+	for _, f := range []string{"a.css", "a.css.map", "b.css", "old.css", "sprite.png"} {
+		err := ioutil.WriteFile(path(f), []byte(f), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManifest(path("out/manifest.json"))
+	m.Add("sass/b.scss", path("b.css"), "", []string{path("sprite.png")})
+	m.Add("sass/a.scss", path("old.css"), "", nil)
+	// Compiling again replaces the files of the entry, missing files
+	// are left out
+	m.Add("sass/a.scss", path("a.css"), path("a.css.map"),
+		[]string{path("sprite.png"), path("missing.png")})
+	if err := m.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(path("out/manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Manifest
+	if err := json.Unmarshal(bs, &got); err != nil {
+		t.Fatal(err)
+	}
+	e := []Artifact{
+		{Path: path("a.css"), Type: "css", Entry: "sass/a.scss"},
+		{Path: path("a.css.map"), Type: "sourcemap", Entry: "sass/a.scss"},
+		// Shared sprites belong to the first entry
+		{Path: path("sprite.png"), Type: "sprite", Entry: "sass/a.scss"},
+		{Path: path("b.css"), Type: "css", Entry: "sass/b.scss"},
+	}
+	if len(got.Files) != len(e) {
+		t.Fatalf("got: %+v wanted: %+v", got.Files, e)
+	}
+	for i, a := range got.Files {
+		e[i].Path = filepath.ToSlash(e[i].Path)
+		e[i].Hash = hashFile(path(filepath.Base(a.Path)))
+		e[i].Size = int64(len(filepath.Base(a.Path)))
+		if a != e[i] {
+			t.Errorf("got: %+v wanted: %+v", a, e[i])
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wellington/spritewell"
+)
+
+var cmdServe = &Command{
+	Name:  "serve",
+	Flags: flag.NewFlagSet("serve", flag.ExitOnError),
+	Short: "run a development server that compiles stylesheets on request",
+	Long: `Serve /css/<name>.css by compiling <name>.scss or <name>.sass from
+the working directory or the import path.  The image, font and generated
+image directories are served alongside.  Compile errors are displayed in
+the page.`,
+}
+
+func init() {
+	cmdServe.Run = runServe
+	compileFlags(cmdServe.Flags)
+	cmdServe.Flags.StringVar(&HTTP, "http", ":8080", "Address to serve on")
+}
+
+func runServe(cmd *Command, args []string) int {
+	style, _ := setup(cmd, args)
+	// Stylesheets are never written to disk, so neither are source maps
+	SourceMapInline = SourceMapInline || SourceMap
+	err := serve(HTTP, newCache(), newCache(), style)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// cssEntry is a compiled stylesheet along with the modification
+// times of every file used to build it.
+type cssEntry struct {
+	css    []byte
+	mtimes map[string]time.Time
+}
+
+// Server compiles stylesheets as they are requested from /css/.
+// Compiled results are cached until one of their inputs changes.
+type Server struct {
+	root          string
+	sprites, imgs *spritewell.SafeImageMap
+	style         int
+
+	mu     sync.Mutex
+	cache  map[string]cssEntry
+	dirs   []string
+	assets map[string]time.Time
+}
+
+// NewServer returns a Server resolving stylesheets relative to root.
+func NewServer(root string, sprites, imgs *spritewell.SafeImageMap, style int) *Server {
+	dirs := assetDirs(root)
+	return &Server{
+		root:    root,
+		sprites: sprites,
+		imgs:    imgs,
+		style:   style,
+		cache:   make(map[string]cssEntry),
+		dirs:    dirs,
+		assets:  scanAssets(dirs),
+	}
+}
+
+// serve starts a development server on addr.  Stylesheets are served
+// from /css/ and the image, font and generated image directories are
+// served at their path relative to the working directory, so the
+// relative urls created by image-url, font-url and sprite resolve.
+func serve(addr string, sprites, imgs *spritewell.SafeImageMap, style int) error {
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/css/", NewServer(root, sprites, imgs, style))
+
+	mounted := map[string]bool{"/css/": true}
+	for _, dir := range []string{Gen, Dir, Font} {
+		if dir == "" {
+			continue
+		}
+		abs, _ := filepath.Abs(dir)
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			log.Printf("Not serving %s, it is outside of %s", dir, root)
+			continue
+		}
+		prefix := path.Clean("/"+filepath.ToSlash(rel)) + "/"
+		if prefix == "//" {
+			prefix = "/"
+		}
+		if mounted[prefix] {
+			continue
+		}
+		mounted[prefix] = true
+		mux.Handle(prefix, http.StripPrefix(prefix,
+			http.FileServer(http.Dir(abs))))
+	}
+
+	log.Printf("Serving on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// ServeHTTP compiles /css/<name>.css from <name>.scss, or <name>.sass,
+// found in the working directory or any of the include paths.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/css/")
+	if !strings.HasSuffix(name, ".css") ||
+		strings.HasPrefix(path.Base(name), "_") {
+		http.NotFound(w, r)
+		return
+	}
+	f, ok := s.lookup(strings.TrimSuffix(name, ".css") + ".scss")
+	if !ok {
+		f, ok = s.lookup(strings.TrimSuffix(name, ".css") + ".sass")
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invalidate()
+	if hit, ok := s.cache[f]; ok && !changed(hit.mtimes) {
+		w.Write(hit.css)
+		return
+	}
+
+	var out bytes.Buffer
+	fout := filepath.Join(s.root, "css", filepath.FromSlash(name))
+	par, _, err := build(f, &out, fout, s.sprites, s.imgs, s.style)
+	if err != nil {
+		log.Println(f)
+		log.Println(err)
+		delete(s.cache, f)
+		w.Write(errorCSS(err))
+		return
+	}
+
+	entry := cssEntry{
+		css:    out.Bytes(),
+		mtimes: make(map[string]time.Time),
+	}
+	entry.mtimes[f] = modTime(f)
+	for _, imp := range par.Imports {
+		entry.mtimes[imp] = modTime(imp)
+	}
+	s.cache[f] = entry
+	w.Write(entry.css)
+}
+
+// lookup finds the stylesheet called name in the working directory
+// or one of the include paths.
+func (s *Server) lookup(name string) (string, bool) {
+	dirs := []string{s.root}
+	if Includes != "" {
+		dirs = append(dirs, strings.Split(Includes, ",")...)
+	}
+	for _, dir := range dirs {
+		f := filepath.Join(dir, filepath.FromSlash(name))
+		if info, err := os.Stat(f); err == nil && !info.IsDir() {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// invalidate drops every cached stylesheet and sprite when an image
+// or font changes.
+func (s *Server) invalidate() {
+	assets := scanAssets(s.dirs)
+	if sameTimes(assets, s.assets) {
+		return
+	}
+	s.assets = assets
+	s.cache = make(map[string]cssEntry)
+	resetCache(s.sprites, s.imgs)
+}
+
+// changed reports whether any of the files in mtimes were modified.
+func changed(mtimes map[string]time.Time) bool {
+	for f, t := range mtimes {
+		if !modTime(f).Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorCSS creates a stylesheet displaying err at the top of the page.
+func errorCSS(err error) []byte {
+	msg := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\A `,
+	).Replace(err.Error())
+	return []byte(fmt.Sprintf(`body:before {
+  display: block;
+  white-space: pre;
+  font-family: monospace;
+  font-size: 14px;
+  color: #000;
+  background: #fdd;
+  border-bottom: 2px solid #c00;
+  padding: 1em;
+  content: "%s";
+}
+`, msg))
+}
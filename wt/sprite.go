@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/wellington/spritewell"
+)
+
+var cmdSprite = &Command{
+	Name:  "sprite",
+	Flags: flag.NewFlagSet("sprite", flag.ExitOnError),
+	Args:  "globs...",
+	Short: "generate sprites without compiling stylesheets",
+	Long: `Combine the images matching each glob into a sprite and write it to
+the generated image directory.  Globs are relative to the image
+directory.  The path of each sprite is printed.`,
+}
+
+var padding int
+
+func init() {
+	fs := cmdSprite.Flags
+	cmdSprite.Run = runSprite
+	fs.StringVar(&Gen, "gen", ".", "Directory for generated images")
+	fs.StringVar(&Dir, "dir", "", "Image directory")
+	fs.StringVar(&Dir, "d", "", "Image directory")
+	fs.IntVar(&padding, "padding", 0, "Space in pixels between images")
+}
+
+func runSprite(cmd *Command, args []string) int {
+	if len(args) == 0 {
+		cmd.Usage()
+		return 2
+	}
+	err := os.MkdirAll(Gen, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := 0
+	for _, glob := range args {
+		imgs := spritewell.ImageList{
+			ImageDir:  Dir,
+			GenImgDir: Gen,
+		}
+		imgs.Padding = padding
+		path, err := exportSprite(&imgs, glob)
+		if err != nil {
+			log.Printf("%s: %s", glob, err)
+			code = 1
+			continue
+		}
+		fmt.Println(filepath.Join(Gen, path))
+	}
+	return code
+}
+
+func exportSprite(imgs *spritewell.ImageList, glob string) (string, error) {
+	err := imgs.Decode(glob)
+	if err != nil {
+		return "", err
+	}
+	_, err = imgs.Combine()
+	if err != nil {
+		return "", err
+	}
+	_, err = imgs.Export()
+	if err != nil {
+		return "", err
+	}
+	return imgs.OutputPath()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wellington/spritewell"
+)
+
+// assetExts are the file types that may be referenced by sprite-map,
+// image-url or font-url.  Changes to these files invalidate every entry.
+var assetExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
+	".eot": true, ".woff": true, ".ttf": true, ".otf": true, ".svg": true,
+}
+
+var cmdWatch = &Command{
+	Name:  "watch",
+	Flags: flag.NewFlagSet("watch", flag.ExitOnError),
+	Args:  "files...",
+	Short: "compile stylesheets and recompile them as their inputs change",
+	Long: `Compile the input files then watch every partial, image and font they
+use.  When a partial changes, only the files importing it are compiled.`,
+}
+
+func init() {
+	cmdWatch.Run = runWatch
+	compileFlags(cmdWatch.Flags)
+	cmdWatch.Flags.IntVar(&Jobs, "j", 1, "Number of files to compile at the same time")
+}
+
+func runWatch(cmd *Command, args []string) int {
+	style, args := setup(cmd, args)
+	files := entries(args)
+	if len(files) == 0 {
+		cmd.Usage()
+		return 2
+	}
+	if err := checkOutputs(files); err != nil {
+		log.Fatal(err)
+	}
+
+	sprites, imgs := newCache(), newCache()
+	var srcDirs []string
+	for _, f := range files {
+		srcDirs = append(srcDirs, filepath.Dir(f))
+	}
+	w := NewWatcher(sprites, imgs, style, assetDirs(srcDirs...))
+	pars := compileAll(files, sprites, imgs, style)
+	for i, f := range files {
+		w.Update(f, pars[i].Imports)
+	}
+	w.Watch()
+	return 0
+}
+
+// Watcher polls the inputs of compiled files and recompiles only the
+// entry files affected by a change.
+type Watcher struct {
+	// Interval is the time between polls of the file system
+	Interval time.Duration
+
+	sprites, imgs *spritewell.SafeImageMap
+	style         int
+	// dirs are scanned for changed images and fonts
+	dirs []string
+
+	// files maps each entry file to the files it imported
+	files map[string][]string
+	// deps is the reverse of files, it maps every imported file
+	// to the entry files that depend on it.
+	deps   map[string]map[string]bool
+	mtimes map[string]time.Time
+	assets map[string]time.Time
+}
+
+// NewWatcher returns a Watcher sharing the sprite and image caches
+// of the initial compile.  Images and fonts are watched in dirs.
+func NewWatcher(sprites, imgs *spritewell.SafeImageMap, style int, dirs []string) *Watcher {
+	w := &Watcher{
+		Interval: 500 * time.Millisecond,
+		sprites:  sprites,
+		imgs:     imgs,
+		style:    style,
+		dirs:     dirs,
+		files:    make(map[string][]string),
+		deps:     make(map[string]map[string]bool),
+		mtimes:   make(map[string]time.Time),
+	}
+	w.assets = scanAssets(dirs)
+	return w
+}
+
+// Update replaces the dependencies recorded for entry with imports.
+// The entry is always a dependency of itself.
+func (w *Watcher) Update(entry string, imports []string) {
+	for _, f := range w.files[entry] {
+		delete(w.deps[f], entry)
+		if len(w.deps[f]) == 0 {
+			delete(w.deps, f)
+			delete(w.mtimes, f)
+		}
+	}
+
+	abs, err := filepath.Abs(entry)
+	if err != nil {
+		abs = entry
+	}
+	files := append([]string{abs}, imports...)
+	w.files[entry] = files
+	for _, f := range files {
+		if _, ok := w.deps[f]; !ok {
+			w.deps[f] = make(map[string]bool)
+		}
+		w.deps[f][entry] = true
+		if _, ok := w.mtimes[f]; !ok {
+			w.mtimes[f] = modTime(f)
+		}
+	}
+}
+
+// Watch blocks forever, recompiling entries as their inputs change.
+func (w *Watcher) Watch() {
+	log.Printf("Watching %d files for changes", len(w.mtimes))
+	for {
+		time.Sleep(w.Interval)
+		w.poll()
+	}
+}
+
+func (w *Watcher) poll() {
+	entries := w.changed()
+	if len(entries) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		log.Println("Compiling:", entry)
+	}
+	pars := compileAll(entries, w.sprites, w.imgs, w.style)
+	for i, entry := range entries {
+		w.Update(entry, pars[i].Imports)
+	}
+}
+
+// changed returns the sorted entries with an input that changed since
+// the last call.  Every entry is returned when an image or font
+// changes, the caches are emptied so they are decoded again.
+func (w *Watcher) changed() []string {
+	dirty := make(map[string]bool)
+	for f, last := range w.mtimes {
+		mod := modTime(f)
+		if mod.Equal(last) {
+			continue
+		}
+		w.mtimes[f] = mod
+		log.Println("Changed:", f)
+		for entry := range w.deps[f] {
+			dirty[entry] = true
+		}
+	}
+
+	assets := scanAssets(w.dirs)
+	if !sameTimes(assets, w.assets) {
+		log.Println("Images or fonts changed, rebuilding all files")
+		w.assets = assets
+		resetCache(w.sprites, w.imgs)
+		for entry := range w.files {
+			dirty[entry] = true
+		}
+	}
+
+	entries := make([]string, 0, len(dirty))
+	for entry := range dirty {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// resetCache empties the sprite and image caches so that images are
+// decoded again on the next compile.
+func resetCache(caches ...*spritewell.SafeImageMap) {
+	for _, cache := range caches {
+		cache.Lock()
+		for k := range cache.M {
+			delete(cache.M, k)
+		}
+		cache.Unlock()
+	}
+}
+
+// assetDirs returns the directories holding images and fonts.  Without
+// -d images are found next to the input files in srcDirs.
+func assetDirs(srcDirs ...string) []string {
+	dirs := []string{Dir}
+	if Dir == "" {
+		dirs = append([]string(nil), srcDirs...)
+	}
+	if Font != "" && Font != "." {
+		dirs = append(dirs, Font)
+	}
+	return unique(dirs)
+}
+
+// scanAssets records the modification time of every image and font
+// in dirs.  Generated sprites are ignored.
+func scanAssets(dirs []string) map[string]time.Time {
+	times := make(map[string]time.Time)
+	gen, _ := filepath.Abs(Gen)
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			abs, _ := filepath.Abs(path)
+			if info.IsDir() {
+				if Gen != "." && abs == gen {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// Sprites are written to the top of Gen
+			if filepath.Dir(abs) == gen {
+				return nil
+			}
+			if assetExts[strings.ToLower(filepath.Ext(path))] {
+				times[abs] = info.ModTime()
+			}
+			return nil
+		})
+	}
+	return times
+}
+
+func sameTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !v.Equal(b[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// modTime returns the modification time of path, or the zero time if
+// path can not be read.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
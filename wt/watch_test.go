@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wellington/spritewell"
+)
+
+// touch writes path, moving its modification time forward by d.
+func touch(t *testing.T, path string, d time.Duration) {
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Now().Add(d)
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.scss"), filepath.Join(dir, "b.scss")
+	one, two := filepath.Join(dir, "_one.scss"), filepath.Join(dir, "_two.scss")
+	for _, f := range []string{a, b, one, two} {
+		touch(t, f, 0)
+	}
+
+	w := NewWatcher(newCache(), newCache(), 0, []string{dir})
+	w.Update(a, []string{one, two})
+	w.Update(b, []string{two})
+
+	deps := func(f string) []string {
+		var entries []string
+		for entry := range w.deps[f] {
+			entries = append(entries, entry)
+		}
+		return unique(entries)
+	}
+	if e := []string{a, b}; !reflect.DeepEqual(deps(two), e) {
+		t.Errorf("got: %v wanted: %v", deps(two), e)
+	}
+	if e := []string{a}; !reflect.DeepEqual(deps(a), e) {
+		t.Errorf("entry is not a dependency of itself got: %v", deps(a))
+	}
+
+	// Imports that are dropped stop being watched
+	w.Update(a, []string{one})
+	if e := []string{b}; !reflect.DeepEqual(deps(two), e) {
+		t.Errorf("got: %v wanted: %v", deps(two), e)
+	}
+	w.Update(b, nil)
+	if _, ok := w.mtimes[two]; ok {
+		t.Errorf("%s is still watched", two)
+	}
+	if _, ok := w.deps[two]; ok {
+		t.Errorf("%s still has dependents", two)
+	}
+}
+
+func TestWatcherChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.scss"), filepath.Join(dir, "b.scss")
+	one, two := filepath.Join(dir, "_one.scss"), filepath.Join(dir, "_two.scss")
+	for _, f := range []string{a, b, one, two} {
+		touch(t, f, 0)
+	}
+
+	w := NewWatcher(newCache(), newCache(), 0, []string{dir})
+	w.Update(a, []string{one, two})
+	w.Update(b, []string{two})
+
+	if got := w.changed(); len(got) != 0 {
+		t.Errorf("nothing changed got: %v", got)
+	}
+
+	// Only the entries importing a partial are compiled
+	touch(t, one, time.Minute)
+	if e, got := []string{a}, w.changed(); !reflect.DeepEqual(got, e) {
+		t.Errorf("got: %v wanted: %v", got, e)
+	}
+	touch(t, two, 2*time.Minute)
+	if e, got := []string{a, b}, w.changed(); !reflect.DeepEqual(got, e) {
+		t.Errorf("got: %v wanted: %v", got, e)
+	}
+	touch(t, b, 3*time.Minute)
+	if e, got := []string{b}, w.changed(); !reflect.DeepEqual(got, e) {
+		t.Errorf("got: %v wanted: %v", got, e)
+	}
+	if got := w.changed(); len(got) != 0 {
+		t.Errorf("changes were reported twice got: %v", got)
+	}
+
+	// Every entry is compiled when an image is added
+	w.sprites.M["*.png0"] = spritewell.ImageList{}
+	touch(t, filepath.Join(dir, "icon.png"), 0)
+	if e, got := []string{a, b}, w.changed(); !reflect.DeepEqual(got, e) {
+		t.Errorf("got: %v wanted: %v", got, e)
+	}
+	if len(w.sprites.M) != 0 {
+		t.Error("sprite cache was not emptied")
+	}
+}